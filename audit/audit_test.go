@@ -0,0 +1,245 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/audit"
+	"github.com/moov-io/base/log"
+)
+
+func TestNewEvent(t *testing.T) {
+	req := httptest.NewRequest("POST", "/transfers", nil)
+	req.Header.Set("X-User-Id", "user-1")
+	req.Header.Set("X-Request-Id", "req-1")
+	req.Header.Set("X-Forwarded-For", "10.1.2.3, 10.0.0.1")
+
+	// Forwarded addresses are ignored unless the request came through a trusted proxy
+	event := audit.NewEvent(req, "transfer.create", "transfers/t1", audit.Success)
+	require.Equal(t, "user-1", event.Actor)
+	require.Equal(t, "req-1", event.RequestID)
+	require.Equal(t, "192.0.2.1", event.RemoteAddr)
+	require.Equal(t, "transfer.create", event.Action)
+	require.Equal(t, "transfers/t1", event.Resource)
+	require.Equal(t, audit.Success, event.Outcome)
+	require.Equal(t, log.String("req-1"), event.Context()["requestID"])
+
+	proxy := audit.WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24"))
+	require.Equal(t, "10.0.0.1", audit.NewEvent(req, "", "", audit.Success, proxy).RemoteAddr)
+
+	internal := audit.WithTrustedProxies(netip.MustParsePrefix("10.0.0.0/24"))
+	require.Equal(t, "10.1.2.3", audit.NewEvent(req, "", "", audit.Success, proxy, internal).RemoteAddr)
+
+	req.Header.Set("X-Forwarded-For", "not-an-ip")
+	require.Equal(t, "192.0.2.1", audit.NewEvent(req, "", "", audit.Success, proxy).RemoteAddr)
+
+	req = httptest.NewRequest("GET", "/transfers", nil)
+	require.Equal(t, "192.0.2.1", audit.NewEvent(req, "", "", audit.Denied).RemoteAddr)
+}
+
+func TestRecorder_FileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	store, err := audit.OpenFileStore(path)
+	require.NoError(t, err)
+
+	captured, logger := log.NewCapturedLogger(t)
+	recorder := audit.NewRecorder(logger, store)
+
+	first, err := recorder.Record(ctx, audit.AuditEvent{
+		Actor:    "user-1",
+		Action:   "transfer.create",
+		Resource: "transfers/t1",
+		Outcome:  audit.Success,
+		Details:  map[string]string{"amount": "100"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first.Sequence)
+	require.Empty(t, first.PrevHash)
+	require.Len(t, first.Hash, 64)
+
+	second, err := recorder.Record(ctx, audit.AuditEvent{
+		Actor:    "user-2",
+		Action:   "transfer.cancel",
+		Resource: "transfers/t1",
+		Outcome:  audit.Denied,
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), second.Sequence)
+	require.Equal(t, first.Hash, second.PrevHash)
+
+	captured.AssertLogged(t, log.Info, "audit", log.Fields{
+		"audit_sequence": log.Uint64(2),
+		"actor":          log.String("user-2"),
+		"outcome":        log.String("denied"),
+	})
+
+	require.NoError(t, audit.Verify(ctx, store))
+	require.NoError(t, store.Close())
+
+	// Reopening continues the chain
+	store, err = audit.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	third, err := audit.NewRecorder(nil, store).Record(ctx, audit.AuditEvent{Actor: "user-1", Action: "login", Outcome: audit.Success})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), third.Sequence)
+	require.Equal(t, second.Hash, third.PrevHash)
+
+	events, err := store.Read(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, second, events[0])
+
+	require.ErrorIs(t, store.Append(ctx, second), audit.ErrSequenceConflict)
+	require.NoError(t, audit.Verify(ctx, store))
+}
+
+func TestFileStore_Read(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	store, err := audit.OpenFileStore(path)
+	require.NoError(t, err)
+
+	recorder := audit.NewRecorder(nil, store)
+	for i := 0; i < 1000; i++ {
+		_, err := recorder.Record(ctx, audit.AuditEvent{Actor: "user-1", Action: "a", Outcome: audit.Success})
+		require.NoError(t, err)
+	}
+
+	requireSequences := func(store *audit.FileStore, after uint64, limit int, first, last uint64) {
+		t.Helper()
+
+		events, err := store.Read(ctx, after, limit)
+		require.NoError(t, err)
+		require.Len(t, events, int(last-first+1))
+		require.Equal(t, first, events[0].Sequence)
+		require.Equal(t, last, events[len(events)-1].Sequence)
+	}
+
+	// Reads seek to events within and across the offsets the store keeps
+	requireSequences(store, 0, 10, 1, 10)
+	requireSequences(store, 255, 3, 256, 258)
+	requireSequences(store, 600, 10, 601, 610)
+	requireSequences(store, 990, 0, 991, 1000)
+	require.NoError(t, audit.Verify(ctx, store))
+	require.NoError(t, store.Close())
+
+	store, err = audit.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	requireSequences(store, 511, 2, 512, 513)
+	requireSequences(store, 999, 10, 1000, 1000)
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	store, err := audit.OpenFileStore(path)
+	require.NoError(t, err)
+
+	recorder := audit.NewRecorder(nil, store)
+	for _, action := range []string{"a", "b", "c", "d"} {
+		_, err := recorder.Record(ctx, audit.AuditEvent{Actor: "user-1", Action: action, Outcome: audit.Success})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.Close())
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+
+	// Modify event 2 and remove event 3
+	lines[1] = strings.Replace(lines[1], `"actor":"user-1"`, `"actor":"user-9"`, 1)
+	lines = append(lines[:2], lines[3:]...)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+
+	store, err = audit.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	err = audit.Verify(ctx, store)
+	require.Error(t, err)
+
+	var list base.ErrorList
+	require.True(t, errors.As(err, &list))
+	require.Len(t, list, 2)
+	require.Equal(t, audit.VerificationError{Sequence: 2, Reason: "hash does not match contents"}, list[0])
+	require.Equal(t, audit.VerificationError{Sequence: 4, Reason: "missing events 3 to 3"}, list[1])
+}
+
+func TestVerify_Key(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	store, err := audit.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	key := audit.WithKey([]byte("secret"))
+	recorder := audit.NewRecorder(nil, store, key)
+	event, err := recorder.Record(ctx, audit.AuditEvent{Actor: "user-1", Action: "login", Outcome: audit.Success})
+	require.NoError(t, err)
+	require.Equal(t, event.ComputeHMAC([]byte("secret")), event.Hash)
+
+	require.NoError(t, audit.Verify(ctx, store, key))
+
+	// A chain recomputed without the key doesn't verify
+	require.Error(t, audit.Verify(ctx, store))
+	require.Error(t, audit.Verify(ctx, store, audit.WithKey([]byte("guess"))))
+}
+
+func TestVerify_Checkpoint(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	store, err := audit.OpenFileStore(path)
+	require.NoError(t, err)
+
+	recorder := audit.NewRecorder(nil, store)
+	var checkpoint audit.Checkpoint
+	for _, action := range []string{"a", "b", "c"} {
+		event, err := recorder.Record(ctx, audit.AuditEvent{Actor: "user-1", Action: action, Outcome: audit.Success})
+		require.NoError(t, err)
+		checkpoint = event.Checkpoint()
+	}
+	require.NoError(t, audit.Verify(ctx, store, audit.WithCheckpoint(checkpoint)))
+	require.NoError(t, store.Close())
+
+	// Removing the newest events leaves a valid chain which only the checkpoint catches
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines[:1], "\n")+"\n"), 0600))
+
+	store, err = audit.OpenFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, audit.Verify(ctx, store))
+
+	err = audit.Verify(ctx, store, audit.WithCheckpoint(checkpoint))
+	var list base.ErrorList
+	require.True(t, errors.As(err, &list))
+	require.Equal(t, base.ErrorList{
+		audit.VerificationError{Sequence: 3, Reason: "checkpoint event is missing, the trail ends at 1"},
+	}, list)
+
+	// Checkpoints also catch a rewritten newest event
+	err = audit.Verify(ctx, store, audit.WithCheckpoint(audit.Checkpoint{Sequence: 1, Hash: checkpoint.Hash}))
+	require.ErrorContains(t, err, "hash does not match checkpoint")
+}
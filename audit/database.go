@@ -0,0 +1,123 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/moov-io/base/database"
+)
+
+// Migrations holds the migrations which create the audit_events table, named
+// migrations/001_create_audit_events.{up,down}.{mysql,postgres}.sql. Copy the files for your database
+// into your application's migrations, renumbered to follow them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+const auditColumns = `sequence, occurred_at, actor, request_id, remote_addr, action, resource, outcome, details, prev_hash, hash`
+
+// NewMySQLStore returns a Store which keeps events in the audit_events table of a MySQL database. See Migrations.
+func NewMySQLStore(db *sql.DB) Store {
+	return &sqlStore{db: db, placeholder: func(int) string { return "?" }}
+}
+
+// NewPostgresStore returns a Store which keeps events in the audit_events table of a Postgres database. See Migrations.
+func NewPostgresStore(db *sql.DB) Store {
+	return &sqlStore{db: db, placeholder: func(i int) string { return fmt.Sprintf("$%d", i) }}
+}
+
+type sqlStore struct {
+	db          *sql.DB
+	placeholder func(i int) string
+}
+
+func (s *sqlStore) Last(ctx context.Context) (*AuditEvent, error) {
+	qry := `SELECT ` + auditColumns + ` FROM audit_events ORDER BY sequence DESC LIMIT 1`
+
+	event, err := scanEvent(s.db.QueryRowContext(ctx, qry))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (s *sqlStore) Append(ctx context.Context, event AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("encoding audit details: %w", err)
+	}
+
+	placeholders := make([]string, 11)
+	for i := range placeholders {
+		placeholders[i] = s.placeholder(i + 1)
+	}
+	qry := `INSERT INTO audit_events (` + auditColumns + `) VALUES (` + strings.Join(placeholders, ", ") + `)`
+
+	_, err = s.db.ExecContext(ctx, qry,
+		event.Sequence, event.Time.UTC(), event.Actor, event.RequestID, event.RemoteAddr,
+		event.Action, event.Resource, string(event.Outcome), string(details), event.PrevHash, event.Hash,
+	)
+	if database.UniqueViolation(err) {
+		return ErrSequenceConflict
+	}
+	return err
+}
+
+func (s *sqlStore) Read(ctx context.Context, after uint64, limit int) ([]AuditEvent, error) {
+	qry := `SELECT ` + auditColumns + ` FROM audit_events WHERE sequence > ` + s.placeholder(1) +
+		` ORDER BY sequence ASC LIMIT ` + s.placeholder(2)
+
+	rows, err := s.db.QueryContext(ctx, qry, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEvent
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, event)
+	}
+	return out, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row scanner) (AuditEvent, error) {
+	var (
+		event   AuditEvent
+		outcome string
+		details string
+	)
+	err := row.Scan(
+		&event.Sequence, &event.Time, &event.Actor, &event.RequestID, &event.RemoteAddr,
+		&event.Action, &event.Resource, &outcome, &details, &event.PrevHash, &event.Hash,
+	)
+	if err != nil {
+		return event, err
+	}
+
+	event.Time = event.Time.UTC()
+	event.Outcome = Outcome(outcome)
+	if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+		return event, fmt.Errorf("reading audit event %d details: %w", event.Sequence, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,67 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/audit"
+	"github.com/moov-io/base/database/testdb"
+)
+
+func TestDatabaseStores(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short flag enabled")
+	}
+
+	t.Run("mysql", func(t *testing.T) {
+		db, _, err := testdb.NewMigratedDatabase(t, "mysql", audit.Migrations)
+		require.NoError(t, err)
+		testStore(t, audit.NewMySQLStore(db))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		db, _, err := testdb.NewMigratedDatabase(t, "postgres", audit.Migrations)
+		require.NoError(t, err)
+		testStore(t, audit.NewPostgresStore(db))
+	})
+}
+
+func testStore(t *testing.T, store audit.Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	last, err := store.Last(ctx)
+	require.NoError(t, err)
+	require.Nil(t, last)
+
+	recorder := audit.NewRecorder(nil, store)
+	first, err := recorder.Record(ctx, audit.AuditEvent{
+		Time:     time.Now().Add(-time.Minute),
+		Actor:    "user-1",
+		Action:   "transfer.create",
+		Resource: "transfers/t1",
+		Outcome:  audit.Success,
+		Details:  map[string]string{"amount": "100"},
+	})
+	require.NoError(t, err)
+
+	second, err := recorder.Record(ctx, audit.AuditEvent{Actor: "user-1", Action: "transfer.cancel", Outcome: audit.Failure})
+	require.NoError(t, err)
+	require.Equal(t, first.Hash, second.PrevHash)
+
+	last, err = store.Last(ctx)
+	require.NoError(t, err)
+	require.Equal(t, second.Hash, last.Hash)
+
+	require.ErrorIs(t, store.Append(ctx, second), audit.ErrSequenceConflict)
+
+	events, err := store.Read(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, first.Details, events[0].Details)
+
+	require.NoError(t, audit.Verify(ctx, store))
+}
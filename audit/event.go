@@ -0,0 +1,176 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package audit records who did what to which resource, when and from where. Each AuditEvent is
+// linked to the one before it by a hash chain so gaps and modified events can be detected. Use
+// WithKey to key the chain with HMAC-SHA256 and WithCheckpoint to detect events removed from the end.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+)
+
+// Outcome is the result of an audited action.
+type Outcome string
+
+const (
+	Success = Outcome("success")
+	Failure = Outcome("failure")
+	Denied  = Outcome("denied")
+)
+
+// AuditEvent is one entry in the audit trail.
+//
+// Sequence, Time, PrevHash and Hash are set by a Recorder.
+type AuditEvent struct {
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+
+	Actor      string `json:"actor"`
+	RequestID  string `json:"request_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	Action   string            `json:"action"`
+	Resource string            `json:"resource"`
+	Outcome  Outcome           `json:"outcome"`
+	Details  map[string]string `json:"details,omitempty"`
+
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// NewEvent returns an AuditEvent for action on resource with the actor, request ID and remote address read from r.
+// The remote address is the address of the connection unless it's a proxy given with WithTrustedProxies.
+func NewEvent(r *http.Request, action, resource string, outcome Outcome, opts ...Option) AuditEvent {
+	return AuditEvent{
+		Actor:      moovhttp.GetUserID(r),
+		RequestID:  moovhttp.GetRequestID(r),
+		RemoteAddr: remoteAddr(r, newOptions(opts)),
+		Action:     action,
+		Resource:   resource,
+		Outcome:    outcome,
+	}
+}
+
+// remoteAddr returns the client address of r. Addresses in X-Forwarded-For are only believed when
+// they were added by trusted proxies, so the header is read from the right until an untrusted
+// address is found.
+func remoteAddr(r *http.Request, o *options) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !o.trusted(addr) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			return host // malformed header, fall back to the proxy's address
+		}
+		if !o.trusted(addr) {
+			return addr.String()
+		}
+		host = addr.String()
+	}
+	return host
+}
+
+// Context returns the fields of e so it can be written with log.Logger.With.
+func (e AuditEvent) Context() map[string]log.Valuer {
+	fields := log.Fields{
+		"audit_sequence": log.Uint64(e.Sequence),
+		"audit_hash":     log.String(e.Hash),
+		"actor":          log.String(e.Actor),
+		"action":         log.String(e.Action),
+		"resource":       log.String(e.Resource),
+		"outcome":        log.String(string(e.Outcome)),
+	}
+	if e.RequestID != "" {
+		fields["requestID"] = log.String(e.RequestID)
+	}
+	if e.RemoteAddr != "" {
+		fields["remote_addr"] = log.String(e.RemoteAddr)
+	}
+	if len(e.Details) > 0 {
+		details := make(log.Fields, len(e.Details))
+		for k, v := range e.Details {
+			details[k] = log.String(v)
+		}
+		fields["details"] = log.Object(details)
+	}
+	return fields
+}
+
+// ComputeHash returns the SHA-256 hash of every field of e other than Hash.
+func (e AuditEvent) ComputeHash() string {
+	return e.computeHash(nil)
+}
+
+// ComputeHMAC returns the HMAC-SHA256 of every field of e other than Hash, used in place of
+// ComputeHash by Recorders given WithKey.
+func (e AuditEvent) ComputeHMAC(key []byte) string {
+	return e.computeHash(key)
+}
+
+func (e AuditEvent) computeHash(key []byte) string {
+	// Empty and nil details hash the same so events survive stores which don't keep the difference
+	details := e.Details
+	if len(details) == 0 {
+		details = nil
+	}
+
+	bs, _ := json.Marshal(struct {
+		Sequence   uint64            `json:"sequence"`
+		Time       string            `json:"time"`
+		Actor      string            `json:"actor"`
+		RequestID  string            `json:"request_id"`
+		RemoteAddr string            `json:"remote_addr"`
+		Action     string            `json:"action"`
+		Resource   string            `json:"resource"`
+		Outcome    Outcome           `json:"outcome"`
+		Details    map[string]string `json:"details"`
+		PrevHash   string            `json:"prev_hash"`
+	}{
+		Sequence:   e.Sequence,
+		Time:       e.Time.UTC().Format(time.RFC3339Nano),
+		Actor:      e.Actor,
+		RequestID:  e.RequestID,
+		RemoteAddr: e.RemoteAddr,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		Outcome:    e.Outcome,
+		Details:    details,
+		PrevHash:   e.PrevHash,
+	})
+
+	var h hash.Hash
+	if key != nil {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(bs)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileStore keeps audit events in a file with one JSON encoded event per line.
+// Only one FileStore (in one process) should write to a file at a time.
+type FileStore struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	last *AuditEvent
+
+	// index holds the offset of every fileIndexInterval-th event so Read can seek near the
+	// events it returns instead of scanning the whole file. It's only used while the events
+	// in the file are in sequence order.
+	index  []fileOffset
+	sorted bool
+	count  int
+	size   int64
+}
+
+// fileIndexInterval is how many events are written between the offsets kept by FileStore.
+const fileIndexInterval = 256
+
+type fileOffset struct {
+	sequence uint64
+	offset   int64
+}
+
+var _ Store = (&FileStore{})
+
+// OpenFileStore opens (or creates) the audit file at path.
+func OpenFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating audit directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit file: %w", err)
+	}
+
+	store := &FileStore{
+		path:   path,
+		file:   file,
+		sorted: true,
+	}
+	store.size, err = store.scan(0, func(event AuditEvent, offset int64) bool {
+		store.indexEvent(event, offset)
+		return true
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// indexEvent records event, which starts at offset, as the newest in the file. Callers must hold s.mu
+// or have exclusive access to s.
+func (s *FileStore) indexEvent(event AuditEvent, offset int64) {
+	if s.last != nil && event.Sequence <= s.last.Sequence {
+		s.sorted = false
+	}
+	if s.count%fileIndexInterval == 0 {
+		s.index = append(s.index, fileOffset{sequence: event.Sequence, offset: offset})
+	}
+	s.count++
+	s.last = &event
+}
+
+func (s *FileStore) Last(_ context.Context) (*AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.last == nil {
+		return nil, nil
+	}
+	last := *s.last
+	return &last, nil
+}
+
+func (s *FileStore) Append(_ context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if s.last != nil && event.Sequence <= s.last.Sequence {
+		return ErrSequenceConflict
+	}
+
+	bs, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding audit event: %w", err)
+	}
+	bs = append(bs, '\n')
+	if _, err := s.file.Write(bs); err != nil {
+		return fmt.Errorf("writing audit event: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("syncing audit file: %w", err)
+	}
+
+	s.indexEvent(event, s.size)
+	s.size += int64(len(bs))
+	return nil
+}
+
+func (s *FileStore) Read(_ context.Context, after uint64, limit int) ([]AuditEvent, error) {
+	var out []AuditEvent
+	_, err := s.scan(s.offsetBefore(after), func(event AuditEvent, _ int64) bool {
+		if event.Sequence > after {
+			out = append(out, event)
+		}
+		return limit <= 0 || len(out) < limit
+	})
+	return out, err
+}
+
+// offsetBefore returns the offset of an event at or before the first event after sequence.
+func (s *FileStore) offsetBefore(sequence uint64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.sorted {
+		return 0
+	}
+	// The last indexed event which isn't after sequence
+	i := sort.Search(len(s.index), func(i int) bool {
+		return s.index[i].sequence > sequence
+	})
+	if i == 0 {
+		return 0
+	}
+	return s.index[i-1].offset
+}
+
+// Close closes the audit file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// scan calls fn with each event in the file, starting from offset, until fn returns false.
+// The offset after the last event read is returned.
+func (s *FileStore) scan(offset int64, fn func(event AuditEvent, offset int64) bool) (int64, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return offset, fmt.Errorf("opening audit file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("seeking audit file: %w", err)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("reading audit file: %w", err)
+		}
+
+		start := offset
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var event AuditEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return offset, fmt.Errorf("reading audit file at byte %d: %w", start, err)
+		}
+		if !fn(event, start) {
+			return offset, nil
+		}
+	}
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+    sequence BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+    occurred_at DATETIME(6) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    request_id VARCHAR(255) NOT NULL,
+    remote_addr VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource VARCHAR(255) NOT NULL,
+    outcome VARCHAR(40) NOT NULL,
+    details TEXT NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL
+);
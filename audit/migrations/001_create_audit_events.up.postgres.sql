@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+    sequence BIGINT NOT NULL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    actor TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    remote_addr TEXT NOT NULL,
+    action TEXT NOT NULL,
+    resource TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    details TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL
+);
@@ -0,0 +1,60 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"net/netip"
+)
+
+// Option configures NewEvent, NewRecorder and Verify.
+type Option func(o *options)
+
+type options struct {
+	key            []byte
+	checkpoint     *Checkpoint
+	trustedProxies []netip.Prefix
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithKey links events with HMAC-SHA256 using key instead of SHA-256, so the chain can't be
+// recomputed by someone who can write to the Store but doesn't have the key. Recorders and
+// Verify must be given the same key.
+func WithKey(key []byte) Option {
+	return func(o *options) {
+		o.key = key
+	}
+}
+
+// WithCheckpoint has Verify check the trail still contains the event of c, so events removed
+// from the end of the trail are detected. Checkpoints should be kept outside the Store.
+func WithCheckpoint(c Checkpoint) Option {
+	return func(o *options) {
+		o.checkpoint = &c
+	}
+}
+
+// WithTrustedProxies has NewEvent read the remote address from the X-Forwarded-For header when
+// the request came through one of proxies. Without it the address of the connection is used.
+func WithTrustedProxies(proxies ...netip.Prefix) Option {
+	return func(o *options) {
+		o.trustedProxies = append(o.trustedProxies, proxies...)
+	}
+}
+
+func (o *options) trusted(addr netip.Addr) bool {
+	for _, p := range o.trustedProxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/moov-io/base/log"
+)
+
+// Store persists audit events in sequence order.
+type Store interface {
+	// Last returns the event with the highest sequence, or nil when the store is empty.
+	Last(ctx context.Context) (*AuditEvent, error)
+
+	// Append saves event. ErrSequenceConflict is returned when an event with the same sequence exists.
+	Append(ctx context.Context, event AuditEvent) error
+
+	// Read returns up to limit events with a sequence greater than after, in sequence order.
+	Read(ctx context.Context, after uint64, limit int) ([]AuditEvent, error)
+}
+
+// ErrSequenceConflict is returned by a Store when another event was appended with the same sequence.
+var ErrSequenceConflict = errors.New("audit event sequence already exists")
+
+// Recorder links events into the hash chain, saves them to a Store and writes them to a log.Logger.
+type Recorder struct {
+	logger log.Logger
+	store  Store
+	key    []byte
+
+	mu sync.Mutex
+}
+
+// NewRecorder returns a Recorder which saves events to store. Events are also logged to logger if it's non-nil.
+func NewRecorder(logger log.Logger, store Store, opts ...Option) *Recorder {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Recorder{
+		logger: logger,
+		store:  store,
+		key:    newOptions(opts).key,
+	}
+}
+
+// conflictRetries is how many times Record reads the latest event again after another
+// process appended an event with the same sequence.
+const conflictRetries = 5
+
+// Record adds event to the end of the audit trail and returns it with Sequence, Time, PrevHash and Hash set.
+func (r *Recorder) Record(ctx context.Context, event AuditEvent) (AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// Databases store microseconds, so keep the hash stable after a round trip
+	event.Time = event.Time.UTC().Truncate(time.Microsecond)
+
+	for attempt := 0; ; attempt++ {
+		last, err := r.store.Last(ctx)
+		if err != nil {
+			return event, fmt.Errorf("reading last audit event: %w", err)
+		}
+
+		event.Sequence, event.PrevHash = 1, ""
+		if last != nil {
+			event.Sequence = last.Sequence + 1
+			event.PrevHash = last.Hash
+		}
+		event.Hash = event.computeHash(r.key)
+
+		err = r.store.Append(ctx, event)
+		if errors.Is(err, ErrSequenceConflict) && attempt < conflictRetries {
+			continue
+		}
+		if err != nil {
+			return event, fmt.Errorf("saving audit event: %w", err)
+		}
+		break
+	}
+
+	r.logger.Info().With(event).Log("audit")
+
+	return event, nil
+}
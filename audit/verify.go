@@ -0,0 +1,115 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/moov-io/base"
+)
+
+// VerificationError describes a problem found in the audit trail.
+type VerificationError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e VerificationError) Error() string {
+	return fmt.Sprintf("audit event %d: %s", e.Sequence, e.Reason)
+}
+
+// Checkpoint is the sequence and hash of a recorded event, kept outside the Store so Verify can
+// detect events removed from the end of the trail.
+type Checkpoint struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// Checkpoint returns the Checkpoint of e.
+func (e AuditEvent) Checkpoint() Checkpoint {
+	return Checkpoint{Sequence: e.Sequence, Hash: e.Hash}
+}
+
+// verifyBatchSize is how many events Verify reads at a time.
+const verifyBatchSize = 500
+
+// Verify reads every event in store and checks that sequences have no gaps, that each event links
+// to the hash of the one before it and that no event was modified after being recorded.
+//
+// Without WithKey anyone able to write to store can rewrite an event and every hash after it, and
+// without WithCheckpoint the newest events can be removed, so both should be used where the trail
+// must be tamper evident.
+//
+// Problems are returned as a base.ErrorList of VerificationError. A nil error means the trail is intact.
+func Verify(ctx context.Context, store Store, opts ...Option) error {
+	o := newOptions(opts)
+
+	var (
+		errs base.ErrorList
+		prev *AuditEvent
+		read uint64
+
+		checkpointFound bool
+	)
+
+	for {
+		events, err := store.Read(ctx, read, verifyBatchSize)
+		if err != nil {
+			return fmt.Errorf("reading audit events after %d: %w", read, err)
+		}
+
+		for i := range events {
+			event := events[i]
+
+			expected := uint64(1)
+			if prev != nil {
+				expected = prev.Sequence + 1
+			}
+			switch {
+			case event.Sequence > expected:
+				errs.Add(VerificationError{Sequence: event.Sequence, Reason: fmt.Sprintf("missing events %d to %d", expected, event.Sequence-1)})
+			case event.Sequence < expected:
+				errs.Add(VerificationError{Sequence: event.Sequence, Reason: "sequence out of order"})
+			case prev != nil && event.PrevHash != prev.Hash:
+				errs.Add(VerificationError{Sequence: event.Sequence, Reason: "previous hash does not match"})
+			case prev == nil && event.PrevHash != "":
+				errs.Add(VerificationError{Sequence: event.Sequence, Reason: "first event has a previous hash"})
+			}
+
+			if event.Hash != event.computeHash(o.key) {
+				errs.Add(VerificationError{Sequence: event.Sequence, Reason: "hash does not match contents"})
+			}
+			if o.checkpoint != nil && event.Sequence == o.checkpoint.Sequence {
+				checkpointFound = true
+				if event.Hash != o.checkpoint.Hash {
+					errs.Add(VerificationError{Sequence: event.Sequence, Reason: "hash does not match checkpoint"})
+				}
+			}
+
+			prev = &event
+			if event.Sequence > read {
+				read = event.Sequence
+			}
+		}
+
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+
+	if o.checkpoint != nil && !checkpointFound {
+		last := uint64(0)
+		if prev != nil {
+			last = prev.Sequence
+		}
+		errs.Add(VerificationError{Sequence: o.checkpoint.Sequence, Reason: fmt.Sprintf("checkpoint event is missing, the trail ends at %d", last)})
+	}
+
+	if errs.Empty() {
+		return nil
+	}
+	return errs
+}
@@ -5,8 +5,10 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/go-viper/mapstructure/v2"
@@ -20,6 +22,10 @@ const APP_CONFIG = "APP_CONFIG"
 
 const APP_CONFIG_SECRETS = "APP_CONFIG_SECRETS"
 
+// APP_CONFIG_SKIP_VALIDATION disables the validation done after loading config when set to true.
+// Validate can still be called directly.
+const APP_CONFIG_SKIP_VALIDATION = "APP_CONFIG_SKIP_VALIDATION"
+
 type Service struct {
 	logger log.Logger
 }
@@ -30,20 +36,32 @@ func NewService(logger log.Logger) Service {
 	}
 }
 
+// Load reads configs/config.default.yml packed by pkger and merges APP_CONFIG and APP_CONFIG_SECRETS over it.
+//
+// Deprecated: pkger is archived. Use LoadFromFS with an embed.FS instead.
 func (s *Service) Load(config interface{}) error {
 	if err := s.LoadFile(pkger.Include("/configs/config.default.yml"), config); err != nil {
 		return err
 	}
 
-	return s.MergeEnvironments(config)
+	if err := s.MergeEnvironments(config); err != nil {
+		return err
+	}
+
+	return s.validateLoaded(config)
 }
 
+// LoadFromFS reads configs/config.default.yml from fs and merges APP_CONFIG and APP_CONFIG_SECRETS over it.
 func (s *Service) LoadFromFS(config interface{}, fs fs.FS) error {
 	if err := s.LoadEmbeddedFile("configs/config.default.yml", config, fs); err != nil {
 		return err
 	}
 
-	return s.MergeEnvironments(config)
+	if err := s.MergeEnvironments(config); err != nil {
+		return err
+	}
+
+	return s.validateLoaded(config)
 }
 
 func (s *Service) MergeEnvironments(config interface{}) error {
@@ -61,6 +79,27 @@ func (s *Service) MergeEnvironments(config interface{}) error {
 	return v.UnmarshalExact(config, overwriteConfig)
 }
 
+// Validate checks the loaded config with Validate and logs any problems found.
+func (s *Service) Validate(config interface{}) error {
+	if err := Validate(config); err != nil {
+		s.logger.LogErrorf("config validation failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// validateLoaded validates config after loading unless APP_CONFIG_SKIP_VALIDATION is set.
+func (s *Service) validateLoaded(config interface{}) error {
+	if skip, _ := strconv.ParseBool(os.Getenv(APP_CONFIG_SKIP_VALIDATION)); skip {
+		s.logger.Warn().Logf("skipping config validation as %s is set", APP_CONFIG_SKIP_VALIDATION)
+		return nil
+	}
+	return s.Validate(config)
+}
+
+// LoadFile reads a file packed by pkger.
+//
+// Deprecated: pkger is archived. Use LoadEmbeddedFile instead.
 func (s *Service) LoadFile(file string, config interface{}) error {
 	logger := s.logger.Set("file", log.String(file))
 	logger.Info().Logf("loading config file")
@@ -70,14 +109,17 @@ func (s *Service) LoadFile(file string, config interface{}) error {
 		return logger.LogErrorf("pkger unable to load %s: %w", file, err).Err()
 	}
 
-	if err := configFromReader(config, f); err != nil {
+	if err := configFromReader(config, f, ConfigType(file)); err != nil {
 		return logger.LogError(err).Err()
 	}
 
 	return nil
 }
 
+// LoadEmbeddedFile reads file from fs. Paths written for pkger (with a leading slash) are accepted.
 func (s *Service) LoadEmbeddedFile(file string, config interface{}, fs fs.FS) error {
+	file = strings.TrimPrefix(file, "/")
+
 	logger := s.logger.Set("file", log.String(file))
 	logger.Info().Logf("loading config file")
 
@@ -86,27 +128,49 @@ func (s *Service) LoadEmbeddedFile(file string, config interface{}, fs fs.FS) er
 		return logger.LogErrorf("go:embed FS unable to load %s: %w", file, err).Err()
 	}
 
-	if err := configFromReader(config, f); err != nil {
+	if err := configFromReader(config, f, ConfigType(file)); err != nil {
 		return logger.LogError(err).Err()
 	}
 
 	return nil
 }
 
-func configFromReader(config interface{}, f io.Reader) error {
+// ConfigType returns the format of a config file based on its extension. Files
+// without a known extension are read as YAML.
+func ConfigType(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".json":
+		return "json"
+	case ".toml":
+		return "toml"
+	default:
+		return "yaml"
+	}
+}
+
+func configFromReader(config interface{}, f io.Reader, configType string) error {
 	deflt := viper.New()
-	deflt.SetConfigType("yaml")
+	deflt.SetConfigType(configType)
 	if err := deflt.ReadConfig(f); err != nil {
 		return fmt.Errorf("unable to load the defaults: %w", err)
 	}
 
-	if err := deflt.UnmarshalExact(config, overwriteConfig); err != nil {
+	if err := decodeSettings(config, deflt.AllSettings()); err != nil {
 		return fmt.Errorf("unable to unmarshal the defaults: %w", err)
 	}
 
 	return nil
 }
 
+// decodeSettings overwrites config with settings using the overwriteConfig decode hooks.
+func decodeSettings(config interface{}, settings map[string]interface{}) error {
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return err
+	}
+	return v.UnmarshalExact(config, overwriteConfig)
+}
+
 func LoadEnvironmentFile(logger log.Logger, envVar string, v *viper.Viper) error {
 	if file, ok := os.LookupEnv(envVar); ok && strings.TrimSpace(file) != "" {
 
@@ -117,6 +181,7 @@ func LoadEnvironmentFile(logger log.Logger, envVar string, v *viper.Viper) error
 		logger.Info().Logf("loading config file")
 
 		v.SetConfigFile(file)
+		v.SetConfigType(ConfigType(file))
 
 		if err := v.MergeInConfig(); err != nil {
 			return logger.LogErrorf("merging config failed: %w", err).Err()
@@ -155,14 +155,31 @@ func Test_WidgetsConfig(t *testing.T) {
 }
 
 func Test_SearchAndSecurityConfig(t *testing.T) {
-	t.Setenv(config.APP_CONFIG, filepath.Join("testdata", "with-search-and-security.yml"))
-	t.Setenv(config.APP_CONFIG_SECRETS, "")
+	for _, file := range []string{"with-search-and-security.yml", "with-search-and-security.json", "with-search-and-security.toml"} {
+		t.Run(file, func(t *testing.T) {
+			t.Setenv(config.APP_CONFIG, filepath.Join("testdata", file))
+			t.Setenv(config.APP_CONFIG_SECRETS, "")
 
-	cfg := &GlobalConfigModel{}
+			cfg := &GlobalConfigModel{}
 
-	service := config.NewService(log.NewDefaultLogger())
-	err := service.LoadFromFS(cfg, base.ConfigDefaults)
-	require.Nil(t, err)
+			service := config.NewService(log.NewDefaultLogger())
+			err := service.LoadFromFS(cfg, base.ConfigDefaults)
+			require.Nil(t, err)
+
+			requireSearchAndSecurity(t, cfg)
+		})
+	}
+}
+
+func Test_ConfigType(t *testing.T) {
+	require.Equal(t, "yaml", config.ConfigType("config.yml"))
+	require.Equal(t, "yaml", config.ConfigType("/etc/config/app"))
+	require.Equal(t, "json", config.ConfigType("config.JSON"))
+	require.Equal(t, "toml", config.ConfigType("testdata/config.toml"))
+}
+
+func requireSearchAndSecurity(t *testing.T, cfg *GlobalConfigModel) {
+	t.Helper()
 
 	// Search
 	patterns := cfg.Config.Search.Patterns
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/moov-io/base/log"
+)
+
+// APP_PROFILE selects a comma separated list of profiles (e.g. "prod,us-east-1") whose files are
+// merged in the order given.
+const APP_PROFILE = "APP_PROFILE"
+
+// APP_CONFIG_DIR names a directory of config fragments which are merged in lexical order.
+const APP_CONFIG_DIR = "APP_CONFIG_DIR"
+
+// Layer is one source of config values. Layers are merged in order with later layers
+// overwriting the values of earlier ones.
+type Layer struct {
+	Name string
+
+	read     func() ([]layerSource, error)
+	embedded bool
+}
+
+type layerSource struct {
+	file     string
+	settings map[string]interface{}
+}
+
+// EmbeddedLayer reads a single required file from fsys.
+func EmbeddedLayer(name string, fsys fs.FS, file string) Layer {
+	return Layer{
+		Name:     name,
+		embedded: true,
+		read: func() ([]layerSource, error) {
+			src, err := readFSFile(fsys, file)
+			if err != nil {
+				return nil, err
+			}
+			return []layerSource{src}, nil
+		},
+	}
+}
+
+// FileLayer reads a single required file from disk.
+func FileLayer(name string, file string) Layer {
+	return Layer{
+		Name: name,
+		read: func() ([]layerSource, error) {
+			src, err := readOSFile(file)
+			if err != nil {
+				return nil, err
+			}
+			return []layerSource{src}, nil
+		},
+	}
+}
+
+// EnvironmentFileLayer reads the file named by envVar, if set. This is how APP_CONFIG and
+// APP_CONFIG_SECRETS are read.
+func EnvironmentFileLayer(envVar string) Layer {
+	return Layer{
+		Name: envVar,
+		read: func() ([]layerSource, error) {
+			file, ok := os.LookupEnv(envVar)
+			if !ok || strings.TrimSpace(file) == "" {
+				return nil, nil
+			}
+			src, err := readOSFile(file)
+			if err != nil {
+				return nil, err
+			}
+			return []layerSource{src}, nil
+		},
+	}
+}
+
+// ProfileLayer reads dir/config.<profile>.yml (or .yaml, .json, .toml) from fsys for each
+// profile listed in APP_PROFILE. Every selected profile must have a file.
+func ProfileLayer(fsys fs.FS, dir string) Layer {
+	return Layer{
+		Name:     APP_PROFILE,
+		embedded: true,
+		read: func() ([]layerSource, error) {
+			var sources []layerSource
+			for _, profile := range Profiles() {
+				src, err := readProfileFile(fsys, dir, profile)
+				if err != nil {
+					return nil, fmt.Errorf("profile %s: %w", profile, err)
+				}
+				sources = append(sources, src)
+			}
+			return sources, nil
+		},
+	}
+}
+
+// DirectoryLayer reads every YAML, JSON and TOML file in dir, merged in lexical order.
+func DirectoryLayer(name string, dir string) Layer {
+	return Layer{
+		Name: name,
+		read: func() ([]layerSource, error) {
+			return readDirectory(dir)
+		},
+	}
+}
+
+// EnvironmentDirectoryLayer reads the directory named by envVar, if set.
+func EnvironmentDirectoryLayer(envVar string) Layer {
+	return Layer{
+		Name: envVar,
+		read: func() ([]layerSource, error) {
+			dir, ok := os.LookupEnv(envVar)
+			if !ok || strings.TrimSpace(dir) == "" {
+				return nil, nil
+			}
+			return readDirectory(dir)
+		},
+	}
+}
+
+// OverridesLayer sets explicit values. Keys are dotted paths such as "Config.Database.DatabaseName".
+func OverridesLayer(name string, values map[string]interface{}) Layer {
+	return Layer{
+		Name: name,
+		read: func() ([]layerSource, error) {
+			v := viper.New()
+			for key, value := range values {
+				v.Set(key, value)
+			}
+			return []layerSource{{settings: v.AllSettings()}}, nil
+		},
+	}
+}
+
+// DefaultLayers returns the standard ordering of layers:
+//
+//  1. configs/config.default.yml from fsys
+//  2. configs/config.<profile>.yml from fsys for each profile in APP_PROFILE
+//  3. APP_CONFIG
+//  4. fragments in the APP_CONFIG_DIR directory
+//  5. APP_CONFIG_SECRETS
+func DefaultLayers(fsys fs.FS) []Layer {
+	return []Layer{
+		EmbeddedLayer("defaults", fsys, "configs/config.default.yml"),
+		ProfileLayer(fsys, "configs"),
+		EnvironmentFileLayer(APP_CONFIG),
+		EnvironmentDirectoryLayer(APP_CONFIG_DIR),
+		EnvironmentFileLayer(APP_CONFIG_SECRETS),
+	}
+}
+
+// Profiles returns the profiles selected by APP_PROFILE.
+func Profiles() []string {
+	var profiles []string
+	for _, profile := range strings.Split(os.Getenv(APP_PROFILE), ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// LoadLayers merges each layer over config in order and validates the result. Layers are
+// merged the same way LoadFromFS merges its files: files read from an fs.FS (EmbeddedLayer and
+// ProfileLayer) are decoded over config one at a time like LoadEmbeddedFile, replacing slices
+// and maps, while consecutive other layers are merged together like MergeEnvironments before
+// being decoded.
+func (s *Service) LoadLayers(config interface{}, layers ...Layer) error {
+	var pending *viper.Viper
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+		v := pending
+		pending = nil
+		return v.UnmarshalExact(config, overwriteConfig)
+	}
+
+	_, err := s.mergeLayers(layers, func(layer Layer, src layerSource) error {
+		logger := s.logger.Set("layer", log.String(layer.Name))
+
+		if layer.embedded {
+			if err := flush(); err != nil {
+				return logger.LogErrorf("unable to unmarshal config layers: %w", err).Err()
+			}
+			if err := decodeSettings(config, src.settings); err != nil {
+				return logger.LogErrorf("unable to unmarshal config layer %s: %w", layer.Name, err).Err()
+			}
+			return nil
+		}
+
+		if pending == nil {
+			pending = viper.New()
+		}
+		if err := pending.MergeConfigMap(src.settings); err != nil {
+			return logger.LogErrorf("merging config layer %s: %w", layer.Name, err).Err()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return s.logger.LogErrorf("unable to unmarshal config layers: %w", err).Err()
+	}
+
+	return s.validateLoaded(config)
+}
+
+// Origin describes which layer supplied the final value of a config key.
+type Origin struct {
+	Key   string // Dotted and lowercased key, e.g. config.database.databasename
+	Layer string
+	File  string // Empty for layers without files, such as overrides
+}
+
+// Explanation lists the Origin of every config key, sorted by key.
+type Explanation []Origin
+
+// Lookup returns the Origin of key. Keys are matched case-insensitively.
+func (e Explanation) Lookup(key string) (Origin, bool) {
+	key = strings.ToLower(key)
+	for _, o := range e {
+		if o.Key == key {
+			return o, true
+		}
+	}
+	return Origin{}, false
+}
+
+// Print writes one line for each key and its origin to w.
+func (e Explanation) Print(w io.Writer) {
+	for _, o := range e {
+		if o.File == "" {
+			fmt.Fprintf(w, "%s\t%s\n", o.Key, o.Layer)
+		} else {
+			fmt.Fprintf(w, "%s\t%s (%s)\n", o.Key, o.Layer, o.File)
+		}
+	}
+}
+
+// Explain merges the layers and reports which layer supplied each final value.
+func (s *Service) Explain(layers ...Layer) (Explanation, error) {
+	origins, err := s.mergeLayers(layers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(Explanation, 0, len(origins))
+	for _, o := range origins {
+		out = append(out, o)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
+
+// mergeLayers reads each layer in order, calling apply (if set) for every source, and
+// returns the origin of each key.
+func (s *Service) mergeLayers(layers []Layer, apply func(Layer, layerSource) error) (map[string]Origin, error) {
+	origins := make(map[string]Origin)
+
+	for _, layer := range layers {
+		logger := s.logger.Set("layer", log.String(layer.Name))
+
+		sources, err := layer.read()
+		if err != nil {
+			return nil, logger.LogErrorf("reading config layer %s: %w", layer.Name, err).Err()
+		}
+
+		for _, src := range sources {
+			if src.file != "" {
+				logger.Set("file", log.String(src.file)).Info().Logf("loading config file")
+			}
+
+			if apply != nil {
+				if err := apply(layer, src); err != nil {
+					return nil, err
+				}
+			}
+
+			// Keys replaced by this source drop any origins nested under (or above) them
+			for _, key := range flattenKeys("", src.settings) {
+				for existing := range origins {
+					if strings.HasPrefix(existing, key+".") || strings.HasPrefix(key, existing+".") {
+						delete(origins, existing)
+					}
+				}
+				origins[key] = Origin{Key: key, Layer: layer.Name, File: src.file}
+			}
+		}
+	}
+
+	return origins, nil
+}
+
+// flattenKeys returns the dotted leaf keys of settings, matching viper's lowercased keys.
+func flattenKeys(prefix string, settings map[string]interface{}) []string {
+	var keys []string
+	for k, v := range settings {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			keys = append(keys, flattenKeys(key, nested)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func readFSFile(fsys fs.FS, file string) (layerSource, error) {
+	f, err := fsys.Open(file)
+	if err != nil {
+		return layerSource{}, fmt.Errorf("unable to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	return readLayerSource(file, f)
+}
+
+var supportedExtensions = []string{".yml", ".yaml", ".json", ".toml"}
+
+func supportedExtension(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, supported := range supportedExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func readProfileFile(fsys fs.FS, dir, profile string) (layerSource, error) {
+	for _, ext := range supportedExtensions {
+		file := path.Join(dir, fmt.Sprintf("config.%s%s", profile, ext))
+		if _, err := fs.Stat(fsys, file); err == nil {
+			return readFSFile(fsys, file)
+		}
+	}
+	return layerSource{}, fmt.Errorf("no config.%s file found in %s", profile, dir)
+}
+
+func readOSFile(file string) (layerSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return layerSource{}, fmt.Errorf("unable to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	return readLayerSource(file, f)
+}
+
+func readLayerSource(file string, r io.Reader) (layerSource, error) {
+	v := viper.New()
+	v.SetConfigType(ConfigType(file))
+	if err := v.ReadConfig(r); err != nil {
+		return layerSource{}, fmt.Errorf("unable to read %s: %w", file, err)
+	}
+	return layerSource{file: file, settings: v.AllSettings()}, nil
+}
+
+func readDirectory(dir string) ([]layerSource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read directory %s: %w", dir, err)
+	}
+
+	// os.ReadDir returns entries sorted by filename
+	var sources []layerSource
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if !supportedExtension(entry.Name()) {
+			continue
+		}
+
+		src, err := readOSFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
@@ -0,0 +1,105 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/config"
+	"github.com/moov-io/base/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_LoadLayers(t *testing.T) {
+	t.Setenv(config.APP_PROFILE, "sandbox, us-east")
+	t.Setenv(config.APP_CONFIG, "")
+	t.Setenv(config.APP_CONFIG_DIR, filepath.Join("testdata", "layers", "fragments"))
+	t.Setenv(config.APP_CONFIG_SECRETS, filepath.Join("..", "configs", "config.secrets.yml"))
+
+	layers := append(config.DefaultLayers(os.DirFS(filepath.Join("testdata", "layers"))),
+		config.OverridesLayer("overrides", map[string]interface{}{
+			"Config.Search.MaxResults": 50,
+		}),
+	)
+
+	cfg := &GlobalConfigModel{}
+	service := config.NewService(log.NewTestLogger())
+	require.NoError(t, service.LoadLayers(cfg, layers...))
+
+	require.Equal(t, "default", cfg.Config.Default)
+	require.Equal(t, "sandbox", cfg.Config.App)
+	require.Equal(t, "us-east", cfg.Config.Zero)
+	require.Equal(t, "keep secret!", cfg.Config.Secret)
+	require.Equal(t, []string{"secret"}, cfg.Config.Values)
+	require.Equal(t, 50, cfg.Config.Search.MaxResults)
+	require.Equal(t, 5*time.Second, cfg.Config.Search.Timeout)
+
+	explained, err := service.Explain(layers...)
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"config.default":           "defaults",
+		"config.app":               config.APP_PROFILE,
+		"config.zero":              config.APP_PROFILE,
+		"config.secret":            config.APP_CONFIG_SECRETS,
+		"config.values":            config.APP_CONFIG_SECRETS,
+		"config.search.timeout":    config.APP_CONFIG_DIR,
+		"config.search.maxresults": "overrides",
+	}
+	require.Len(t, explained, len(expected))
+	for key, layer := range expected {
+		origin, found := explained.Lookup(key)
+		require.True(t, found, key)
+		require.Equal(t, layer, origin.Layer, key)
+	}
+
+	origin, _ := explained.Lookup("Config.Zero")
+	require.Equal(t, "configs/config.us-east.yml", origin.File)
+
+	var buf strings.Builder
+	explained.Print(&buf)
+	require.Contains(t, buf.String(), "config.search.timeout\tAPP_CONFIG_DIR (testdata/layers/fragments/10-search.yml)\n")
+	require.Contains(t, buf.String(), "config.search.maxresults\toverrides\n")
+}
+
+func TestService_LoadLayers_MissingProfile(t *testing.T) {
+	t.Setenv(config.APP_PROFILE, "staging")
+
+	cfg := &GlobalConfigModel{}
+	service := config.NewService(log.NewTestLogger())
+	err := service.LoadLayers(cfg, config.DefaultLayers(os.DirFS(filepath.Join("testdata", "layers")))...)
+	require.ErrorContains(t, err, "profile staging")
+}
+
+func TestService_LoadLayers_UnknownKeys(t *testing.T) {
+	cfg := &GlobalConfigModel{}
+	service := config.NewService(log.NewTestLogger())
+	err := service.LoadLayers(cfg, config.FileLayer("extra", filepath.Join("..", "configs", "config.extra.yml")))
+	require.ErrorContains(t, err, `'Config' has invalid keys: extra`)
+}
+
+func TestService_LoadLayers_MatchesLoadFromFS(t *testing.T) {
+	t.Setenv(config.APP_PROFILE, "")
+	t.Setenv(config.APP_CONFIG_DIR, "")
+
+	for _, files := range [][2]string{
+		{filepath.Join("..", "configs", "config.app.yml"), filepath.Join("..", "configs", "config.secrets.yml")},
+		{filepath.Join("testdata", "with-widgets.yml"), filepath.Join("testdata", "with-widget-secrets.yml")},
+	} {
+		t.Setenv(config.APP_CONFIG, files[0])
+		t.Setenv(config.APP_CONFIG_SECRETS, files[1])
+
+		service := config.NewService(log.NewTestLogger())
+
+		expected := &GlobalConfigModel{}
+		require.NoError(t, service.LoadFromFS(expected, base.ConfigDefaults))
+
+		// Slices and maps are merged the same way as LoadFromFS
+		layered := &GlobalConfigModel{}
+		require.NoError(t, service.LoadLayers(layered, config.DefaultLayers(base.ConfigDefaults)...))
+		require.Equal(t, expected, layered)
+	}
+}
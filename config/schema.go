@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// JSONSchemaDraft is the JSON Schema version produced by GenerateSchema.
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document, or a subschema of one.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema `json:"patternProperties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	MinItems  *int     `json:"minItems,omitempty"`
+	MaxItems  *int     `json:"maxItems,omitempty"`
+}
+
+// durationPattern matches the strings accepted by time.ParseDuration.
+const durationPattern = `^[-+]?(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+$|^0$`
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	regexpType          = reflect.TypeOf(regexp.Regexp{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// GenerateSchema produces a JSON Schema describing the config files accepted for config.
+//
+// Property names follow the Go field name or `mapstructure` tag, descriptions are read from
+// `description` struct tags and `validate` tags are converted into their schema equivalents.
+// Structs do not allow additional properties, matching the unknown key checks done when loading.
+// Keys are matched case-insensitively (through patternProperties) as viper lowercases them.
+//
+// The schema describes a single config file, which is usually one of several merged layers, so
+// `required` rules are not included. Validate checks them against the merged config instead.
+func GenerateSchema(config interface{}) (*Schema, error) {
+	t := reflect.TypeOf(config)
+	if t == nil {
+		return nil, fmt.Errorf("unable to generate schema for nil config")
+	}
+
+	schema, err := schemaFor(t, make(map[reflect.Type]bool))
+	if err != nil {
+		return nil, err
+	}
+	schema.Schema = JSONSchemaDraft
+	schema.Title = t.String()
+	return schema, nil
+}
+
+func schemaFor(t reflect.Type, visiting map[reflect.Type]bool) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == durationType:
+		// Integers are read as nanoseconds
+		return &Schema{AnyOf: []*Schema{
+			{Type: "string", Pattern: durationPattern},
+			{Type: "integer"},
+		}}, nil
+	case t == regexpType:
+		return &Schema{Type: "string", Format: "regex"}, nil
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFor(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := schemaFor(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+
+	case reflect.Struct:
+		return structSchema(t, visiting)
+	}
+
+	return nil, fmt.Errorf("unsupported config type %s", t)
+}
+
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) (*Schema, error) {
+	// Recursive types are left open rather than expanded forever
+	if visiting[t] {
+		return &Schema{Type: "object"}, nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	schema := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		PatternProperties:    make(map[string]*Schema),
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		prop, err := schemaFor(field.Type, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+
+		// Squashed embedded structs contribute their properties directly
+		if field.Anonymous && strings.Contains(field.Tag.Get("mapstructure"), ",squash") {
+			for name, p := range prop.Properties {
+				schema.Properties[name] = p
+			}
+			for pattern, p := range prop.PatternProperties {
+				schema.PatternProperties[pattern] = p
+			}
+			continue
+		}
+
+		name := fieldName(field)
+		prop.Description = field.Tag.Get("description")
+
+		if err := applyRules(prop, field.Type, field.Tag.Get("validate")); err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+
+		schema.Properties[name] = prop
+		schema.PatternProperties[caseInsensitivePattern(name)] = prop
+	}
+
+	return schema, nil
+}
+
+// caseInsensitivePattern returns a regex matching name in any case. JSON Schema patterns
+// don't support flags, so each letter is written as a character class.
+func caseInsensitivePattern(name string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for _, r := range name {
+		lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+		if lower == upper {
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+			continue
+		}
+		buf.WriteString("[" + string(upper) + string(lower) + "]")
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// applyRules converts `validate` rules into schema keywords.
+func applyRules(schema *Schema, t reflect.Type, tag string) error {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "", "required":
+			continue
+		case "oneof":
+			schema.Enum = strings.Fields(arg)
+		case "url":
+			schema.Format = "uri"
+		case "min", "max":
+			if err := applyBound(schema, t, name == "min", arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func applyBound(schema *Schema, t reflect.Type, min bool, arg string) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return nil // durations are written as strings or nanoseconds
+	}
+
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return fmt.Errorf("invalid bound %q: %w", arg, err)
+	}
+	length := int(limit)
+
+	switch schema.Type {
+	case "integer", "number":
+		if min {
+			schema.Minimum = &limit
+		} else {
+			schema.Maximum = &limit
+		}
+	case "string":
+		if min {
+			schema.MinLength = &length
+		} else {
+			schema.MaxLength = &length
+		}
+	case "array":
+		if min {
+			schema.MinItems = &length
+		} else {
+			schema.MaxItems = &length
+		}
+	}
+	return nil
+}
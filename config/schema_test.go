@@ -0,0 +1,75 @@
+package config_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/moov-io/base/config"
+	"github.com/stretchr/testify/require"
+)
+
+type SchemaConfig struct {
+	Name    string            `description:"Name of the service" validate:"required,max=20"`
+	Mode    string            `validate:"oneof=dev prod"`
+	Port    int               `validate:"min=1,max=65535"`
+	Ratio   *float64          `mapstructure:"x-ratio"`
+	Hosts   []string          `validate:"min=1"`
+	Labels  map[string]string `validate:"required"`
+	Model   ConfigModel
+	private string
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema, err := config.GenerateSchema(&SchemaConfig{})
+	require.NoError(t, err)
+
+	require.Equal(t, config.JSONSchemaDraft, schema.Schema)
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, false, schema.AdditionalProperties)
+	require.NotContains(t, string(mustMarshal(t, schema)), `"required"`)
+	require.NotContains(t, schema.Properties, "private")
+
+	name := schema.Properties["Name"]
+	require.Equal(t, "string", name.Type)
+	require.Equal(t, "Name of the service", name.Description)
+	require.Equal(t, 20, *name.MaxLength)
+
+	require.Equal(t, []string{"dev", "prod"}, schema.Properties["Mode"].Enum)
+	require.Equal(t, float64(65535), *schema.Properties["Port"].Maximum)
+	require.Equal(t, "number", schema.Properties["x-ratio"].Type)
+	require.Equal(t, 1, *schema.Properties["Hosts"].MinItems)
+	require.Equal(t, &config.Schema{Type: "string"}, schema.Properties["Labels"].AdditionalProperties)
+
+	search := schema.Properties["Model"].Properties["Search"]
+	require.Equal(t, "regex", search.Properties["Patterns"].Items.Format)
+	timeout := search.Properties["Timeout"]
+	require.Len(t, timeout.AnyOf, 2)
+	require.Equal(t, "string", timeout.AnyOf[0].Type)
+	require.Regexp(t, timeout.AnyOf[0].Pattern, "1m30s")
+	require.Equal(t, "integer", timeout.AnyOf[1].Type)
+
+	security := schema.Properties["Model"].Properties["Security"]
+	require.Contains(t, security.Properties, "x-audience")
+
+	// Keys are matched regardless of their case
+	pattern := "^[Xx]-[Aa][Uu][Dd][Ii][Ee][Nn][Cc][Ee]$"
+	require.Contains(t, security.PatternProperties, pattern)
+	require.Regexp(t, pattern, "X-AUDIENCE")
+	require.Regexp(t, pattern, "x-audience")
+	require.Equal(t, security.Properties["x-audience"], security.PatternProperties[pattern])
+
+	widgets := schema.Properties["Model"].Properties["Widgets"]
+	require.Equal(t, "object", widgets.Type)
+
+	bs := mustMarshal(t, schema)
+	require.Contains(t, string(bs), `"$schema":"https://json-schema.org/draft/2020-12/schema"`)
+	require.Contains(t, string(bs), `"additionalProperties":false`)
+}
+
+func mustMarshal(t *testing.T, schema *config.Schema) []byte {
+	t.Helper()
+
+	bs, err := json.Marshal(schema)
+	require.NoError(t, err)
+	return bs
+}
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+)
+
+// Validator can be implemented by any config struct (or nested struct) to perform
+// checks which can't be expressed with `validate` struct tags.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError describes a single problem found with a config value.
+type ValidationError struct {
+	Field string // Dotted path to the field, e.g. Config.Database.MySQL.Address
+	Err   error
+}
+
+func (e ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks config against its `validate` struct tags and calls Validate() on every
+// struct which implements Validator. All problems are returned together as a base.ErrorList.
+//
+// Supported rules (comma separated) are:
+//
+//	required       the value must not be the zero value
+//	min=N, max=N   bounds on numbers, durations (e.g. min=1s) and the length of strings, slices and maps
+//	oneof=a b c    the value must be one of the space separated options
+//	url            the value must be an absolute URL
+//	hostport       the value must be a host:port pair
+//
+// Rules other than required, min and max are skipped for empty values.
+func Validate(config interface{}) error {
+	var el base.ErrorList
+	validateValue(&el, "", reflect.ValueOf(config), make(map[visit]bool))
+	if el.Empty() {
+		return nil
+	}
+	return el
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// visit is a pointer which was followed. A struct and its first field share an address, so the
+// type is included to tell them apart.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func validateValue(el *base.ErrorList, path string, v reflect.Value, seen map[visit]bool) {
+	if !v.IsValid() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		validateValue(el, path, v.Elem(), seen)
+
+	case reflect.Interface:
+		if !v.IsNil() {
+			validateValue(el, path, v.Elem(), seen)
+		}
+
+	case reflect.Struct:
+		validateStruct(el, path, v, seen)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(el, fmt.Sprintf("%s[%d]", path, i), v.Index(i), seen)
+		}
+
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// Map values aren't addressable, copy them so pointer receiver Validate methods are called
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			validateValue(el, joinPath(path, fmt.Sprintf("%v", iter.Key().Interface())), value, seen)
+		}
+	}
+}
+
+func validateStruct(el *base.ErrorList, path string, v reflect.Value, seen map[visit]bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldPath := joinPath(path, fieldName(field))
+		fieldValue := v.Field(i)
+
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			for _, err := range checkRules(tag, fieldValue) {
+				el.Add(ValidationError{Field: fieldPath, Err: err})
+			}
+		}
+
+		// Embedded (squashed) structs share the path of their parent
+		if field.Anonymous {
+			fieldPath = path
+		}
+		validateValue(el, fieldPath, fieldValue, seen)
+	}
+
+	// Validate methods promoted from an embedded field were called for that field
+	if promotesValidator(t) {
+		return
+	}
+	if err := callValidator(v); err != nil {
+		el.Add(ValidationError{Field: path, Err: err})
+	}
+}
+
+func callValidator(v reflect.Value) error {
+	if v.CanAddr() && v.Addr().Type().Implements(validatorType) {
+		return v.Addr().Interface().(Validator).Validate()
+	}
+	if v.Type().Implements(validatorType) && v.CanInterface() {
+		return v.Interface().(Validator).Validate()
+	}
+	return nil
+}
+
+// promotesValidator reports if the Validate method of struct type t is promoted from an exported
+// embedded field rather than declared on t. Promoted methods are wrappers generated by the compiler,
+// which have no source file.
+func promotesValidator(t reflect.Type) bool {
+	method, ok := t.MethodByName("Validate")
+	if !ok {
+		method, ok = reflect.PointerTo(t).MethodByName("Validate")
+	}
+	if !ok {
+		return false
+	}
+	fn := runtime.FuncForPC(method.Func.Pointer())
+	if fn == nil {
+		return false
+	}
+	if file, _ := fn.FileLine(method.Func.Pointer()); file != "<autogenerated>" {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.IsExported() &&
+			(field.Type.Implements(validatorType) || reflect.PointerTo(field.Type).Implements(validatorType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName returns the name used for a field in config files.
+func fieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("mapstructure"); ok {
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func checkRules(tag string, v reflect.Value) []error {
+	var errs []error
+	for _, rule := range strings.Split(tag, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(rule, "=")
+		if err := checkRule(name, arg, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+var errRequired = errors.New("is required")
+
+func checkRule(name, arg string, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if name == "required" {
+				return errRequired
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return errRequired
+		}
+		return nil
+
+	case "min", "max":
+		n, limit, err := compareBound(v, arg)
+		if err != nil {
+			return err
+		}
+		if name == "min" && n < limit {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+		if name == "max" && n > limit {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+		return nil
+	}
+
+	// The remaining rules only apply to non-empty values
+	if v.IsZero() {
+		return nil
+	}
+	value := fmt.Sprintf("%v", v.Interface())
+
+	switch name {
+	case "oneof":
+		for _, option := range strings.Fields(arg) {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s] but found %q", arg, value)
+
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("must be an absolute URL but found %q", value)
+		}
+		return nil
+
+	case "hostport":
+		host, port, err := net.SplitHostPort(value)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("must be a host:port pair but found %q", value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown validation rule %q", name)
+}
+
+// compareBound returns v and arg as comparable numbers. Strings, slices and maps are measured by their length.
+func compareBound(v reflect.Value, arg string) (float64, float64, error) {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		limit, err := time.ParseDuration(arg)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid duration bound %q: %w", arg, err)
+		}
+		return float64(v.Int()), float64(limit), nil
+	}
+
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid bound %q: %w", arg, err)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), limit, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), limit, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), limit, nil
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), limit, nil
+	}
+	return 0, 0, fmt.Errorf("min/max is not supported for %s", v.Type())
+}
@@ -0,0 +1,217 @@
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/config"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/log"
+	"github.com/stretchr/testify/require"
+)
+
+type ValidatedConfig struct {
+	Name     string        `validate:"required"`
+	Port     int           `validate:"min=1,max=65535"`
+	Mode     string        `validate:"oneof=dev sandbox prod"`
+	Endpoint string        `validate:"url"`
+	Upstream string        `validate:"hostport"`
+	Timeout  time.Duration `validate:"min=1s"`
+	Tags     []string      `validate:"max=2"`
+
+	Hooked   *HookedConfig
+	Database database.DatabaseConfig
+}
+
+type HookedConfig struct {
+	Enabled bool
+	Target  string
+}
+
+func (h *HookedConfig) Validate() error {
+	if h.Enabled && h.Target == "" {
+		return errors.New("target is required when enabled")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	cfg := ValidatedConfig{
+		Name:     "svc",
+		Port:     8080,
+		Mode:     "prod",
+		Endpoint: "https://moov.io/v1",
+		Upstream: "localhost:443",
+		Timeout:  5 * time.Second,
+	}
+	require.NoError(t, config.Validate(&cfg))
+
+	// empty values are allowed for oneof, url and hostport
+	cfg.Mode, cfg.Endpoint, cfg.Upstream = "", "", ""
+	require.NoError(t, config.Validate(&cfg))
+}
+
+func TestValidate_Errors(t *testing.T) {
+	cfg := ValidatedConfig{
+		Port:     0,
+		Mode:     "qa",
+		Endpoint: "moov.io",
+		Upstream: "localhost",
+		Timeout:  time.Millisecond,
+		Tags:     []string{"a", "b", "c"},
+		Hooked:   &HookedConfig{Enabled: true},
+		Database: database.DatabaseConfig{
+			MySQL: &database.MySQLConfig{
+				Connections: database.ConnectionsConfig{
+					MaxOpen: -1,
+				},
+			},
+		},
+	}
+
+	err := config.Validate(&cfg)
+	require.Error(t, err)
+
+	var el base.ErrorList
+	require.ErrorAs(t, err, &el)
+
+	var fields []string
+	for _, e := range el {
+		var verr config.ValidationError
+		require.ErrorAs(t, e, &verr)
+		fields = append(fields, verr.Field)
+	}
+	require.Equal(t, []string{
+		"Name",
+		"Port",
+		"Mode",
+		"Endpoint",
+		"Upstream",
+		"Timeout",
+		"Tags",
+		"Hooked",
+		"Database.MySQL.Address",
+		"Database.MySQL.Connections.MaxOpen",
+		"Database",
+	}, fields)
+
+	require.Contains(t, err.Error(), "Name: is required")
+	require.Contains(t, err.Error(), "Port: must be at least 1")
+	require.Contains(t, err.Error(), `Mode: must be one of [dev sandbox prod] but found "qa"`)
+	require.Contains(t, err.Error(), "Hooked: target is required when enabled")
+	require.Contains(t, err.Error(), "Database: database name is required")
+}
+
+func TestValidate_NestedPaths(t *testing.T) {
+	type Item struct {
+		ID string `validate:"required"`
+	}
+	type Root struct {
+		Items  []Item
+		ByName map[string]Item
+		Named  string `mapstructure:"x-named" validate:"required"`
+	}
+
+	err := config.Validate(&Root{
+		Items:  []Item{{ID: "a"}, {}},
+		ByName: map[string]Item{"first": {}},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Items[1].ID: is required")
+	require.Contains(t, err.Error(), "ByName.first.ID: is required")
+	require.Contains(t, err.Error(), "x-named: is required")
+
+	// Pointer receiver Validate methods are called for map values
+	err = config.Validate(&struct {
+		Hooks map[string]HookedConfig
+	}{
+		Hooks: map[string]HookedConfig{"first": {Enabled: true}},
+	})
+	require.ErrorContains(t, err, "Hooks.first: target is required when enabled")
+}
+
+type EmbeddedHookConfig struct {
+	HookedConfig
+}
+
+type OverriddenHookConfig struct {
+	HookedConfig
+}
+
+func (o *OverriddenHookConfig) Validate() error {
+	return errors.New("overridden")
+}
+
+func TestValidate_Embedded(t *testing.T) {
+	// Promoted Validate methods are called once
+	err := config.Validate(&EmbeddedHookConfig{HookedConfig: HookedConfig{Enabled: true}})
+	var el base.ErrorList
+	require.ErrorAs(t, err, &el)
+	require.Len(t, el, 1)
+	require.EqualError(t, el[0], "target is required when enabled")
+
+	// Declared Validate methods are called along with those of embedded fields
+	err = config.Validate(&OverriddenHookConfig{HookedConfig: HookedConfig{Enabled: true}})
+	require.ErrorAs(t, err, &el)
+	require.Len(t, el, 2)
+	require.EqualError(t, el[0], "target is required when enabled")
+	require.EqualError(t, el[1], "overridden")
+
+	// Pointers to a struct's first field are followed even though they share its address
+	type Item struct {
+		ID string `validate:"required"`
+	}
+	type Root struct {
+		First Item
+		Ref   *Item
+	}
+	root := &Root{}
+	root.Ref = &root.First
+	err = config.Validate(root)
+	require.ErrorContains(t, err, "First.ID: is required")
+	require.ErrorContains(t, err, "Ref.ID: is required")
+}
+
+type ValidatedGlobalConfig struct {
+	Config ValidatedModel
+}
+
+type ValidatedModel struct {
+	Default string `validate:"required"`
+	App     string `validate:"oneof=app"`
+	Secret  string `validate:"min=50"`
+	Values  []string
+	Zero    string
+}
+
+func TestService_LoadValidates(t *testing.T) {
+	t.Setenv(config.APP_CONFIG, filepath.Join("..", "configs", "config.app.yml"))
+	t.Setenv(config.APP_CONFIG_SECRETS, filepath.Join("..", "configs", "config.secrets.yml"))
+
+	cfg := &ValidatedGlobalConfig{}
+
+	service := config.NewService(log.NewTestLogger())
+	err := service.LoadFromFS(cfg, base.ConfigDefaults)
+	require.Error(t, err)
+
+	var el base.ErrorList
+	require.ErrorAs(t, err, &el)
+	require.Len(t, el, 1)
+	require.Equal(t, "Config.Secret: must be at least 50", el[0].Error())
+}
+
+func TestService_LoadSkipValidation(t *testing.T) {
+	t.Setenv(config.APP_CONFIG, filepath.Join("..", "configs", "config.app.yml"))
+	t.Setenv(config.APP_CONFIG_SECRETS, filepath.Join("..", "configs", "config.secrets.yml"))
+	t.Setenv(config.APP_CONFIG_SKIP_VALIDATION, "true")
+
+	cfg := &ValidatedGlobalConfig{}
+
+	service := config.NewService(log.NewTestLogger())
+	require.NoError(t, service.LoadFromFS(cfg, base.ConfigDefaults))
+	require.NoError(t, service.LoadLayers(cfg, config.DefaultLayers(base.ConfigDefaults)...))
+	require.Error(t, service.Validate(cfg))
+}
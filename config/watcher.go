@@ -0,0 +1,285 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/moov-io/base/log"
+)
+
+// watchDebounce groups the bursts of events written by editors and Kubernetes ConfigMap updates
+// (which swap a ..data symlink) into a single reload.
+const watchDebounce = 250 * time.Millisecond
+
+// Watcher keeps a config of type T up to date with the files read by DefaultLayers: the files
+// named by APP_CONFIG and APP_CONFIG_SECRETS, every fragment in the APP_CONFIG_DIR directory and
+// the configs/config.<profile> files for each profile in APP_PROFILE. Whenever one of those files
+// changes (or a fragment is added or removed) the load function is called again and subscribers
+// are notified with the old and new config.
+//
+// Profile files are found relative to the working directory. Profiles read from an embedded
+// filesystem can't change while the process runs.
+//
+// Reloads which fail (including failed validation) are rejected and the current config is kept.
+type Watcher[T any] struct {
+	logger log.Logger
+	load   func(*T) error
+
+	files   []string // watched individually
+	dirs    []string // every supported file inside is watched
+	watcher *fsnotify.Watcher
+
+	reloadMu sync.Mutex
+
+	mu          sync.RWMutex
+	current     *T
+	hashes      map[string][]byte
+	subscribers map[int]func(old, new *T)
+	nextID      int
+
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	wg        sync.WaitGroup
+}
+
+// NewWatcher performs the initial load and starts watching for changes. The load function
+// should run the full load, merge and validate pipeline, for example:
+//
+//	service := config.NewService(logger)
+//	watcher, err := config.NewWatcher(logger, func(cfg *GlobalConfig) error {
+//		return service.LoadFromFS(cfg, configs)
+//	})
+func NewWatcher[T any](logger log.Logger, load func(*T) error) (*Watcher[T], error) {
+	w := &Watcher[T]{
+		logger:      logger.Set("component", log.String("ConfigWatcher")),
+		load:        load,
+		subscribers: make(map[int]func(old, new *T)),
+		done:        make(chan struct{}),
+	}
+
+	for _, envVar := range []string{APP_CONFIG, APP_CONFIG_SECRETS} {
+		if file, ok := os.LookupEnv(envVar); ok && strings.TrimSpace(file) != "" {
+			w.files = append(w.files, filepath.Clean(file))
+		}
+	}
+	for _, profile := range Profiles() {
+		for _, ext := range supportedExtensions {
+			file := filepath.Join("configs", fmt.Sprintf("config.%s%s", profile, ext))
+			if _, err := os.Stat(file); err == nil {
+				w.files = append(w.files, file)
+			}
+		}
+	}
+	if dir, ok := os.LookupEnv(APP_CONFIG_DIR); ok && strings.TrimSpace(dir) != "" {
+		w.dirs = append(w.dirs, filepath.Clean(dir))
+	}
+
+	w.current = new(T)
+	if err := w.load(w.current); err != nil {
+		return nil, err
+	}
+	w.hashes = w.hashFiles()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, w.logger.LogErrorf("creating file watcher: %w", err).Err()
+	}
+	w.watcher = watcher
+
+	// Watch the directories rather than the files so symlink swaps and editors which
+	// replace files are noticed.
+	watchDirs := append([]string{}, w.dirs...)
+	for _, file := range w.files {
+		watchDirs = append(watchDirs, filepath.Dir(file))
+	}
+	dirs := make(map[string]bool)
+	for _, dir := range watchDirs {
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, w.logger.LogErrorf("watching %s: %w", dir, err).Err()
+		}
+	}
+
+	w.wg.Add(1)
+	go w.run()
+
+	return w, nil
+}
+
+// Current returns the most recently loaded config. The returned value must not be modified.
+func (w *Watcher[T]) Current() *T {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.current
+}
+
+// Subscribe registers fn to be called after every successful reload. The returned
+// function removes the subscription.
+func (w *Watcher[T]) Subscribe(fn func(old, new *T)) (unsubscribe func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subscribers[id] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.subscribers, id)
+	}
+}
+
+// Reload loads the config again regardless of whether the files have changed.
+func (w *Watcher[T]) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	next := new(T)
+	if err := w.load(next); err != nil {
+		return w.logger.LogErrorf("rejected config reload: %w", err).Err()
+	}
+
+	w.mu.Lock()
+	old := w.current
+	w.current = next
+	w.hashes = w.hashFiles()
+
+	subscribers := make([]func(old, new *T), 0, len(w.subscribers))
+	for _, fn := range w.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	w.mu.Unlock()
+
+	w.logger.Info().Logf("config reloaded")
+
+	for _, fn := range subscribers {
+		fn(old, next)
+	}
+	return nil
+}
+
+// Close stops watching for changes. It is safe to call more than once.
+func (w *Watcher[T]) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.closeErr = w.watcher.Close()
+		w.wg.Wait()
+	})
+	return w.closeErr
+}
+
+func (w *Watcher[T]) run() {
+	defer w.wg.Done()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+			debounce = time.After(watchDebounce)
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warn().LogErrorf("watching config files: %w", err)
+
+		case <-debounce:
+			debounce = nil
+			if w.changed() {
+				_ = w.Reload()
+			}
+		}
+	}
+}
+
+// changed reports if any watched file has different contents than the last load, or if
+// fragments were added to or removed from a watched directory. Files which can't be read
+// (such as during a symlink swap) are not considered changed.
+func (w *Watcher[T]) changed() bool {
+	hashes := w.hashFiles()
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	for _, file := range w.files {
+		if _, ok := hashes[file]; !ok {
+			return false
+		}
+	}
+
+	if len(hashes) != len(w.hashes) {
+		return true
+	}
+	for file, hash := range hashes {
+		if !bytes.Equal(hash, w.hashes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher[T]) hashFiles() map[string][]byte {
+	files := append([]string{}, w.files...)
+	for _, dir := range w.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			w.logger.Warn().LogErrorf("reading %s: %w", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !supportedExtension(entry.Name()) {
+				continue
+			}
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	hashes := make(map[string][]byte, len(files))
+	for _, file := range files {
+		hash, err := hashFile(file)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				w.logger.Warn().LogErrorf("reading %s: %w", file, err)
+			}
+			continue
+		}
+		hashes[file] = hash
+	}
+	return hashes
+}
+
+func hashFile(path string) ([]byte, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	sum := sha256.Sum256(bs)
+	return sum[:], nil
+}
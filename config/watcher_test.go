@@ -0,0 +1,178 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/config"
+	"github.com/moov-io/base/log"
+	"github.com/stretchr/testify/require"
+)
+
+type WatchedGlobalConfig struct {
+	Config WatchedConfig
+}
+
+type WatchedConfig struct {
+	Default string
+	App     string `validate:"required"`
+	Secret  string
+	Values  []string
+	Zero    string
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	appFile := filepath.Join(dir, "config.app.yml")
+	writeFile(t, appFile, "Config:\n  App: v1\n")
+
+	t.Setenv(config.APP_CONFIG, appFile)
+	t.Setenv(config.APP_CONFIG_SECRETS, "")
+
+	logger := log.NewTestLogger()
+	service := config.NewService(logger)
+	watcher, err := config.NewWatcher(logger, func(cfg *WatchedGlobalConfig) error {
+		return service.LoadFromFS(cfg, base.ConfigDefaults)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, watcher.Close()) })
+
+	require.Equal(t, "v1", watcher.Current().Config.App)
+	require.Equal(t, "default", watcher.Current().Config.Default)
+
+	changes := make(chan [2]string, 10)
+	watcher.Subscribe(func(old, new *WatchedGlobalConfig) {
+		changes <- [2]string{old.Config.App, new.Config.App}
+	})
+
+	// Valid change
+	writeFile(t, appFile, "Config:\n  App: v2\n")
+	require.Equal(t, [2]string{"v1", "v2"}, waitForChange(t, changes))
+	require.Equal(t, "v2", watcher.Current().Config.App)
+
+	// Failing validation is rejected
+	writeFile(t, appFile, "Config:\n  App: \"\"\n")
+	select {
+	case change := <-changes:
+		t.Fatalf("unexpected reload: %v", change)
+	case <-time.After(time.Second):
+	}
+	require.Equal(t, "v2", watcher.Current().Config.App)
+
+	// Recovering from the invalid file
+	writeFile(t, appFile, "Config:\n  App: v3\n")
+	require.Equal(t, [2]string{"v2", "v3"}, waitForChange(t, changes))
+}
+
+func TestWatcher_SymlinkSwap(t *testing.T) {
+	// Mimic how Kubernetes updates a mounted ConfigMap
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "v1", "config.app.yml"), "Config:\n  App: v1\n")
+	writeFile(t, filepath.Join(dir, "v2", "config.app.yml"), "Config:\n  App: v2\n")
+
+	require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.app.yml"), filepath.Join(dir, "config.app.yml")))
+
+	t.Setenv(config.APP_CONFIG, filepath.Join(dir, "config.app.yml"))
+	t.Setenv(config.APP_CONFIG_SECRETS, "")
+
+	logger := log.NewTestLogger()
+	service := config.NewService(logger)
+	watcher, err := config.NewWatcher(logger, func(cfg *WatchedGlobalConfig) error {
+		return service.LoadFromFS(cfg, base.ConfigDefaults)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, watcher.Close()) })
+
+	changes := make(chan [2]string, 10)
+	unsubscribe := watcher.Subscribe(func(old, new *WatchedGlobalConfig) {
+		changes <- [2]string{old.Config.App, new.Config.App}
+	})
+
+	require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	require.Equal(t, [2]string{"v1", "v2"}, waitForChange(t, changes))
+
+	unsubscribe()
+	require.NoError(t, watcher.Reload())
+	require.Empty(t, changes)
+}
+
+func TestWatcher_Layers(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	writeFile(t, filepath.Join("configs", "config.default.yml"), "Config:\n  Default: default\n")
+	writeFile(t, filepath.Join("configs", "config.prod.yml"), "Config:\n  App: v1\n")
+	writeFile(t, filepath.Join("fragments", "10-secret.yml"), "Config:\n  Secret: s1\n")
+
+	t.Setenv(config.APP_PROFILE, "prod")
+	t.Setenv(config.APP_CONFIG_DIR, "fragments")
+	t.Setenv(config.APP_CONFIG, "")
+	t.Setenv(config.APP_CONFIG_SECRETS, "")
+
+	logger := log.NewTestLogger()
+	service := config.NewService(logger)
+	watcher, err := config.NewWatcher(logger, func(cfg *WatchedGlobalConfig) error {
+		return service.LoadLayers(cfg, config.DefaultLayers(os.DirFS("."))...)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, watcher.Close()) })
+
+	changes := make(chan [2]string, 10)
+	watcher.Subscribe(func(old, new *WatchedGlobalConfig) {
+		changes <- [2]string{old.Config.App + "/" + old.Config.Secret, new.Config.App + "/" + new.Config.Secret}
+	})
+
+	// Profile files
+	writeFile(t, filepath.Join("configs", "config.prod.yml"), "Config:\n  App: v2\n")
+	require.Equal(t, [2]string{"v1/s1", "v2/s1"}, waitForChange(t, changes))
+
+	// Fragments which change, are added and are removed
+	writeFile(t, filepath.Join("fragments", "10-secret.yml"), "Config:\n  Secret: s2\n")
+	require.Equal(t, [2]string{"v2/s1", "v2/s2"}, waitForChange(t, changes))
+
+	writeFile(t, filepath.Join("fragments", "20-secret.yml"), "Config:\n  Secret: s3\n")
+	require.Equal(t, [2]string{"v2/s2", "v2/s3"}, waitForChange(t, changes))
+
+	require.NoError(t, os.Remove(filepath.Join("fragments", "20-secret.yml")))
+	require.Equal(t, [2]string{"v2/s3", "v2/s2"}, waitForChange(t, changes))
+}
+
+func TestWatcher_CloseTwice(t *testing.T) {
+	t.Setenv(config.APP_CONFIG, filepath.Join("..", "configs", "config.app.yml"))
+	t.Setenv(config.APP_CONFIG_SECRETS, "")
+
+	logger := log.NewTestLogger()
+	service := config.NewService(logger)
+	watcher, err := config.NewWatcher(logger, func(cfg *GlobalConfigModel) error {
+		return service.LoadFromFS(cfg, base.ConfigDefaults)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, watcher.Close())
+	require.NoError(t, watcher.Close())
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+}
+
+func waitForChange(t *testing.T, changes chan [2]string) [2]string {
+	t.Helper()
+
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for config reload")
+	}
+	return [2]string{}
+}
@@ -41,6 +41,12 @@ func New(ctx context.Context, logger log.Logger, config DatabaseConfig) (*sql.DB
 			return nil, fmt.Errorf("connecting to postgres: %w", err)
 		}
 		return ApplyConnectionsConfig(db, &config.Postgres.Connections, logger), nil
+	} else if config.SQLite != nil {
+		db, err := sqliteConnection(logger, *config.SQLite, config.DatabaseName)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to sqlite: %w", err)
+		}
+		return ApplyConnectionsConfig(db, &config.SQLite.Connections, logger), nil
 	}
 
 	return nil, ErrMissingConfig
@@ -76,7 +82,7 @@ func NewAndMigrate(ctx context.Context, logger log.Logger, config DatabaseConfig
 // UniqueViolation returns true when the provided error matches a database error
 // for duplicate entries (violating a unique table constraint).
 func UniqueViolation(err error) bool {
-	return MySQLUniqueViolation(err) || SpannerUniqueViolation(err) || PostgresUniqueViolation(err)
+	return MySQLUniqueViolation(err) || SpannerUniqueViolation(err) || PostgresUniqueViolation(err) || SQLiteUniqueViolation(err)
 }
 
 func DataTooLong(err error) bool {
@@ -84,7 +90,7 @@ func DataTooLong(err error) bool {
 }
 
 func DeadlockFound(err error) bool {
-	return MySQLDeadlockFound(err) || PostgresDeadlockFound(err)
+	return MySQLDeadlockFound(err) || PostgresDeadlockFound(err) || SQLiteDeadlockFound(err)
 }
 
 func ApplyConnectionsConfig(db *sql.DB, connections *ConnectionsConfig, logger log.Logger) *sql.DB {
@@ -0,0 +1,125 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/moov-io/base/log"
+)
+
+// LeaderElection runs work on one process at a time by holding a Lock while it's the leader.
+type LeaderElection struct {
+	lock   *Lock
+	logger log.Logger
+
+	mu    sync.RWMutex
+	lease *Lease
+	err   error
+	ready bool
+}
+
+// NewLeaderElection returns an election where the leader is whoever holds lock.
+func NewLeaderElection(logger log.Logger, lock *Lock) *LeaderElection {
+	return &LeaderElection{
+		lock:   lock,
+		logger: logger.Set("lock", log.String(lock.name)),
+	}
+}
+
+// Run campaigns for leadership until ctx is cancelled. Each time this process becomes the leader
+// lead is called with a context which is cancelled when leadership is lost or ctx is cancelled.
+// Once lead returns the lock is released and the process campaigns again.
+func (e *LeaderElection) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	for {
+		lease, err := e.lock.TryAcquire(ctx)
+		switch {
+		case err == nil:
+			e.setState(lease, nil)
+			e.logger.Info().Set("token", log.Int64(lease.Token())).Log("Elected leader")
+
+			e.lead(ctx, lease, lead)
+
+			e.setState(nil, nil)
+			if err := lease.Release(context.Background()); err != nil {
+				e.logger.Warn().LogErrorf("releasing leadership: %w", err)
+			}
+
+		case errors.Is(err, ErrLockHeld):
+			e.setState(nil, nil)
+
+		case ctx.Err() != nil:
+
+		default:
+			e.setState(nil, err)
+			e.logger.Warn().LogErrorf("campaigning for leadership: %w", err)
+		}
+
+		if err := sleepContext(ctx, e.lock.cfg.RetryInterval); err != nil {
+			e.setState(nil, err)
+			return nil
+		}
+	}
+}
+
+func (e *LeaderElection) lead(ctx context.Context, lease *Lease, lead func(ctx context.Context)) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stop := context.AfterFunc(lease.Context(), func() {
+		cancel(context.Cause(lease.Context()))
+	})
+	defer stop()
+
+	lead(ctx)
+}
+
+func (e *LeaderElection) setState(lease *Lease, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lease, e.err = lease, err
+	e.ready = e.ready || err == nil
+}
+
+// IsLeader returns true while this process holds the lock.
+func (e *LeaderElection) IsLeader() bool {
+	_, leader := e.Token()
+	return leader
+}
+
+// Token returns the fencing token of the current leadership, if this process is the leader.
+func (e *LeaderElection) Token() (int64, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.lease == nil || e.lease.Context().Err() != nil {
+		return 0, false
+	}
+	return e.lease.Token(), true
+}
+
+// ReadinessCheck returns a check for admin.Server's AddReadinessCheck. It fails until the election
+// has reached the database and whenever its last attempt failed. With leaderOnly it also fails while
+// another process is the leader, for services where only the leader should receive traffic.
+func (e *LeaderElection) ReadinessCheck(leaderOnly bool) func() error {
+	return func() error {
+		e.mu.RLock()
+		ready, err := e.ready, e.err
+		e.mu.RUnlock()
+
+		switch {
+		case err != nil:
+			return fmt.Errorf("leader election: %w", err)
+		case !ready:
+			return errors.New("leader election has not started")
+		case leaderOnly && !e.IsLeader():
+			return errors.New("not the leader")
+		}
+		return nil
+	}
+}
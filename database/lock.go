@@ -0,0 +1,463 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	kitprom "github.com/go-kit/kit/metrics/prometheus"
+	stdprom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/log"
+)
+
+var (
+	// ErrLockHeld is returned by Lock.TryAcquire when another process holds the lock.
+	ErrLockHeld = errors.New("lock is held by another process")
+
+	// ErrLockLost is the cause of a Lease's context when the lock could not be renewed.
+	ErrLockLost = errors.New("lock was lost")
+
+	// ErrLockReleased is the cause of a Lease's context after Release.
+	ErrLockReleased = errors.New("lock was released")
+)
+
+var lockHeld = kitprom.NewGaugeFrom(stdprom.GaugeOpts{
+	Name: "database_lock_held",
+	Help: "If this process holds each named lock (1) or not (0).",
+}, []string{"name"})
+
+// LockConfig controls how long a lock is held for without renewal and how often it's retried.
+type LockConfig struct {
+	// TTL is how long a lease lasts without being renewed, which happens every third of the TTL.
+	// MySQL and Postgres locks are released as soon as their connection closes while Spanner and
+	// SQLite leases expire after the TTL. Defaults to 30 seconds.
+	TTL time.Duration
+
+	// RetryInterval is how long Acquire waits between attempts. Defaults to one second.
+	RetryInterval time.Duration
+}
+
+// Lock is a named lock shared by every process using the same database.
+//
+// MySQL uses GET_LOCK, Postgres uses session advisory locks, and Spanner and SQLite use rows of a
+// database_locks lease table. Each time the lock changes hands the new Lease has a larger fencing
+// token, which can be stored alongside writes to reject any from a previous holder.
+type Lock struct {
+	name    string
+	logger  log.Logger
+	cfg     LockConfig
+	owner   string
+	backend lockBackend
+}
+
+type lockBackend interface {
+	// acquire returns ErrLockHeld when another process holds the lock.
+	acquire(ctx context.Context, name, owner string, ttl time.Duration) (lockHandle, int64, error)
+}
+
+type lockHandle interface {
+	// renew returns an error wrapping ErrLockLost when the lock is no longer held.
+	renew(ctx context.Context, ttl time.Duration) error
+	release(ctx context.Context) error
+}
+
+// NewLock returns the lock called name in db, creating the tables locks need if they don't exist.
+func NewLock(ctx context.Context, logger log.Logger, db *sql.DB, config DatabaseConfig, name string, cfg LockConfig) (*Lock, error) {
+	if name == "" {
+		return nil, errors.New("lock name is required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+
+	var (
+		backend lockBackend
+		setup   string
+	)
+	switch {
+	case config.MySQL != nil:
+		backend, setup = &mysqlLocks{db: db, prefix: config.DatabaseName}, mysqlLockTokensTable
+	case config.Postgres != nil:
+		backend, setup = &postgresLocks{db: db}, postgresLockTokensTable
+	case config.Spanner != nil:
+		backend, setup = &leaseLocks{db: db}, spannerLocksTable
+	case config.SQLite != nil:
+		backend, setup = &leaseLocks{db: db}, sqliteLocksTable
+	default:
+		return nil, errors.New("database config not defined")
+	}
+	if _, err := db.ExecContext(ctx, setup); err != nil {
+		return nil, fmt.Errorf("creating lock table: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	return &Lock{
+		name:    name,
+		logger:  logger.Set("lock", log.String(name)),
+		cfg:     cfg,
+		owner:   fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), base.ID()),
+		backend: backend,
+	}, nil
+}
+
+// TryAcquire makes one attempt to take the lock, returning ErrLockHeld when another process holds it.
+func (l *Lock) TryAcquire(ctx context.Context) (*Lease, error) {
+	handle, token, err := l.backend.acquire(ctx, l.name, l.owner, l.cfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+	l.logger.Info().Set("token", log.Int64(token)).Log("Lock acquired")
+	lockHeld.With("name", l.name).Set(1)
+
+	return newLease(l, handle, token), nil
+}
+
+// Acquire waits until the lock is taken or ctx is cancelled.
+func (l *Lock) Acquire(ctx context.Context) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(ctx)
+		if !errors.Is(err, ErrLockHeld) {
+			return lease, err
+		}
+		if err := sleepContext(ctx, l.cfg.RetryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Lease is a held Lock which is renewed in the background until it's released or lost.
+type Lease struct {
+	lock   *Lock
+	handle lockHandle
+	token  int64
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	release  sync.Once
+	released error
+}
+
+func newLease(l *Lock, handle lockHandle, token int64) *Lease {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	lease := &Lease{
+		lock:    l,
+		handle:  handle,
+		token:   token,
+		ctx:     ctx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go lease.renew()
+	return lease
+}
+
+// Token is the fencing token of this lease, which is larger than the token of every earlier holder.
+func (l *Lease) Token() int64 {
+	return l.token
+}
+
+// Context is cancelled once the lease is lost or released, with ErrLockLost or ErrLockReleased
+// as its context.Cause.
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Release stops renewing the lease and gives up the lock.
+func (l *Lease) Release(ctx context.Context) error {
+	l.release.Do(func() {
+		close(l.stop)
+		<-l.stopped
+
+		l.released = l.handle.release(ctx)
+		l.cancel(ErrLockReleased)
+		lockHeld.With("name", l.lock.name).Set(0)
+
+		l.lock.logger.Info().Set("token", log.Int64(l.token)).Log("Lock released")
+	})
+	return l.released
+}
+
+func (l *Lease) renew() {
+	defer close(l.stopped)
+
+	interval := l.lock.cfg.TTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := l.handle.renew(ctx, l.lock.cfg.TTL)
+		cancel()
+
+		switch {
+		case err == nil:
+			renewed = time.Now()
+			continue
+		case errors.Is(err, ErrLockLost):
+		case time.Since(renewed) < l.lock.cfg.TTL:
+			l.lock.logger.Warn().LogErrorf("renewing lock: %w", err)
+			continue
+		default:
+			err = fmt.Errorf("%w: %w", ErrLockLost, err)
+		}
+
+		l.lock.logger.Error().Set("token", log.Int64(l.token)).LogErrorf("Lock lost: %w", err)
+		lockHeld.With("name", l.lock.name).Set(0)
+		l.cancel(err)
+		return
+	}
+}
+
+// sessionLock is a MySQL or Postgres lock held by a connection until it's released or closed.
+type sessionLock struct {
+	conn *sql.Conn
+	key  interface{}
+
+	// checkQuery returns true while conn holds the lock
+	checkQuery   string
+	releaseQuery string
+}
+
+func (s *sessionLock) renew(ctx context.Context, _ time.Duration) error {
+	var held bool
+	if err := s.conn.QueryRowContext(ctx, s.checkQuery, s.key).Scan(&held); err != nil {
+		// The lock goes with the connection, other errors such as timeouts are retried until the TTL passes
+		if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+			return fmt.Errorf("%w: %w", ErrLockLost, err)
+		}
+		return err
+	}
+	if !held {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (s *sessionLock) release(ctx context.Context) error {
+	_, err := s.conn.ExecContext(ctx, s.releaseQuery, s.key)
+	return errors.Join(err, s.conn.Close())
+}
+
+const mysqlLockTokensTable = `CREATE TABLE IF NOT EXISTS database_lock_tokens (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	token BIGINT NOT NULL
+)`
+
+type mysqlLocks struct {
+	db     *sql.DB
+	prefix string
+}
+
+// key returns the GET_LOCK name, which is shared by every database on the server and limited to 64 characters.
+func (m *mysqlLocks) key(name string) string {
+	key := m.prefix + "." + name
+	if len(key) > 64 {
+		sum := sha256.Sum256([]byte(key))
+		key = "lock." + hex.EncodeToString(sum[:])[:59]
+	}
+	return key
+}
+
+func (m *mysqlLocks) acquire(ctx context.Context, name, _ string, _ time.Duration) (lockHandle, int64, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := m.key(name)
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("getting lock: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, 0, ErrLockHeld
+	}
+
+	lock := &sessionLock{
+		conn:         conn,
+		key:          key,
+		checkQuery:   `SELECT COALESCE(IS_USED_LOCK(?) = CONNECTION_ID(), 0)`,
+		releaseQuery: `SELECT RELEASE_LOCK(?)`,
+	}
+
+	var token int64
+	_, err = conn.ExecContext(ctx, `INSERT INTO database_lock_tokens (name, token) VALUES (?, 1) ON DUPLICATE KEY UPDATE token = token + 1`, name)
+	if err == nil {
+		err = conn.QueryRowContext(ctx, `SELECT token FROM database_lock_tokens WHERE name = ?`, name).Scan(&token)
+	}
+	if err != nil {
+		return nil, 0, errors.Join(fmt.Errorf("incrementing fencing token: %w", err), lock.release(ctx))
+	}
+	return lock, token, nil
+}
+
+const postgresLockTokensTable = `CREATE TABLE IF NOT EXISTS database_lock_tokens (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	token BIGINT NOT NULL
+)`
+
+type postgresLocks struct {
+	db *sql.DB
+}
+
+// postgresLockKey returns the advisory lock key for name, which is never negative.
+func postgresLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64() & 0x7fffffffffffffff)
+}
+
+func (p *postgresLocks) acquire(ctx context.Context, name, _ string, _ time.Duration) (lockHandle, int64, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	key := postgresLockKey(name)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("getting advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, 0, ErrLockHeld
+	}
+
+	lock := &sessionLock{
+		conn: conn,
+		key:  key,
+		checkQuery: `SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted
+AND objsubid = 1 AND ((classid::bigint << 32) | objid::bigint) = $1)`,
+		releaseQuery: `SELECT pg_advisory_unlock($1)`,
+	}
+
+	var token int64
+	err = conn.QueryRowContext(ctx, `INSERT INTO database_lock_tokens (name, token) VALUES ($1, 1)
+ON CONFLICT (name) DO UPDATE SET token = database_lock_tokens.token + 1 RETURNING token`, name).Scan(&token)
+	if err != nil {
+		return nil, 0, errors.Join(fmt.Errorf("incrementing fencing token: %w", err), lock.release(ctx))
+	}
+	return lock, token, nil
+}
+
+const spannerLocksTable = `CREATE TABLE IF NOT EXISTS database_locks (
+	name STRING(255) NOT NULL,
+	owner STRING(255) NOT NULL,
+	token INT64 NOT NULL,
+	expires_at INT64 NOT NULL,
+) PRIMARY KEY (name)`
+
+const sqliteLocksTable = `CREATE TABLE IF NOT EXISTS database_locks (
+	name TEXT NOT NULL PRIMARY KEY,
+	owner TEXT NOT NULL,
+	token INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+)`
+
+// leaseLocks are rows of database_locks which expire unless they're renewed. expires_at is
+// in unix nanoseconds, so the clocks of each process need to be in sync.
+type leaseLocks struct {
+	db *sql.DB
+}
+
+// leaseRetries retries lease updates which conflict with another process.
+var leaseRetries = &RetryConfig{
+	MaxAttempts: 3,
+	MinDuration: 10 * time.Millisecond,
+	MaxDuration: 100 * time.Millisecond,
+}
+
+func (s *leaseLocks) acquire(ctx context.Context, name, owner string, ttl time.Duration) (lockHandle, int64, error) {
+	var token int64
+	err := InTx(ctx, s.db, TxOptions{Retries: leaseRetries}, func(tx *sql.Tx) error {
+		now := time.Now()
+
+		var current, expiresAt int64
+		err := tx.QueryRowContext(ctx, `SELECT token, expires_at FROM database_locks WHERE name = ?`, name).Scan(&current, &expiresAt)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			token = 1
+			_, err = tx.ExecContext(ctx, `INSERT INTO database_locks (name, owner, token, expires_at) VALUES (?, ?, ?, ?)`,
+				name, owner, token, now.Add(ttl).UnixNano())
+			return err
+		case err != nil:
+			return err
+		case expiresAt > now.UnixNano():
+			return ErrLockHeld
+		}
+
+		token = current + 1
+		res, err := tx.ExecContext(ctx, `UPDATE database_locks SET owner = ?, token = ?, expires_at = ? WHERE name = ? AND token = ?`,
+			owner, token, now.Add(ttl).UnixNano(), name, current)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return ErrLockHeld
+		}
+		return nil
+	})
+	if UniqueViolation(err) {
+		return nil, 0, ErrLockHeld
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &leaseLock{db: s.db, name: name, owner: owner, token: token}, token, nil
+}
+
+type leaseLock struct {
+	db    *sql.DB
+	name  string
+	owner string
+	token int64
+}
+
+func (l *leaseLock) renew(ctx context.Context, ttl time.Duration) error {
+	res, err := l.db.ExecContext(ctx, `UPDATE database_locks SET expires_at = ? WHERE name = ? AND owner = ? AND token = ?`,
+		time.Now().Add(ttl).UnixNano(), l.name, l.owner, l.token)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *leaseLock) release(ctx context.Context) error {
+	// The row is kept so the next holder's token is larger
+	_, err := l.db.ExecContext(ctx, `UPDATE database_locks SET expires_at = 0 WHERE name = ? AND owner = ? AND token = ?`,
+		l.name, l.owner, l.token)
+	return err
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/log"
+)
+
+func TestSessionLock_Renew(t *testing.T) {
+	ctx := context.Background()
+	db, err := New(ctx, log.NewTestLogger(), DatabaseConfig{
+		DatabaseName: "locks",
+		SQLite:       &SQLiteConfig{Path: filepath.Join(t.TempDir(), "locks.db")},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+
+	lock := &sessionLock{conn: conn, key: 1, checkQuery: `SELECT ? = 1`}
+	require.NoError(t, lock.renew(ctx, time.Second))
+
+	// Failed checks are retried by the Lease until the TTL passes
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = lock.renew(cancelled, time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotErrorIs(t, err, ErrLockLost)
+
+	lock.key = 2
+	require.ErrorIs(t, lock.renew(ctx, time.Second), ErrLockLost)
+
+	// The lock goes with a closed connection
+	lock.key = 1
+	require.NoError(t, conn.Close())
+	require.ErrorIs(t, lock.renew(ctx, time.Second), ErrLockLost)
+}
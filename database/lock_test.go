@@ -0,0 +1,272 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+func setupLocks(t *testing.T, config database.DatabaseConfig, cfg database.LockConfig) (*database.Lock, *database.Lock, *sql.DB) {
+	t.Helper()
+
+	ctx := context.Background()
+	open := func() *sql.DB {
+		db, err := database.New(ctx, log.NewTestLogger(), config)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	db := open()
+	first, err := database.NewLock(ctx, log.NewTestLogger(), db, config, "jobs", cfg)
+	require.NoError(t, err)
+	second, err := database.NewLock(ctx, log.NewTestLogger(), open(), config, "jobs", cfg)
+	require.NoError(t, err)
+
+	return first, second, db
+}
+
+func sqliteLockDatabase(t *testing.T) database.DatabaseConfig {
+	t.Helper()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+	return config
+}
+
+func mysqlLockDatabase(t *testing.T) database.DatabaseConfig {
+	t.Helper()
+
+	config := database.DatabaseConfig{
+		DatabaseName: "locks" + base.ID(),
+		MySQL: &database.MySQLConfig{
+			Address:  "tcp(127.0.0.1:3306)",
+			User:     "root",
+			Password: "root",
+		},
+	}
+	require.NoError(t, testdb.NewMySQLDatabase(t, config))
+	return config
+}
+
+func postgresLockDatabase(t *testing.T) database.DatabaseConfig {
+	t.Helper()
+
+	config := database.DatabaseConfig{
+		DatabaseName: "locks" + base.ID(),
+		Postgres: &database.PostgresConfig{
+			Address:  "127.0.0.1:5432",
+			User:     "moov",
+			Password: "moov",
+		},
+	}
+	require.NoError(t, testdb.NewPostgresDatabase(t, config))
+	return config
+}
+
+func TestLock(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		testLock(t, sqliteLockDatabase(t))
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("-short flag enabled")
+		}
+		testLock(t, mysqlLockDatabase(t))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("-short flag enabled")
+		}
+		testLock(t, postgresLockDatabase(t))
+	})
+}
+
+func testLock(t *testing.T, config database.DatabaseConfig) {
+	t.Helper()
+
+	ctx := context.Background()
+	first, second, _ := setupLocks(t, config, database.LockConfig{
+		TTL:           time.Second,
+		RetryInterval: 10 * time.Millisecond,
+	})
+
+	lease, err := first.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), lease.Token())
+
+	_, err = second.TryAcquire(ctx)
+	require.ErrorIs(t, err, database.ErrLockHeld)
+
+	// Acquire gives up with the context
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = second.Acquire(waitCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Once released the next holder has a larger fencing token
+	acquired := make(chan *database.Lease)
+	go func() {
+		lease, err := second.Acquire(ctx)
+		require.NoError(t, err)
+		acquired <- lease
+	}()
+
+	require.NoError(t, lease.Release(ctx))
+	require.NoError(t, lease.Release(ctx))
+	require.ErrorIs(t, context.Cause(lease.Context()), database.ErrLockReleased)
+
+	next := <-acquired
+	require.Equal(t, int64(2), next.Token())
+	require.NoError(t, next.Context().Err())
+	require.NoError(t, next.Release(ctx))
+}
+
+func TestLock_Lost(t *testing.T) {
+	ctx := context.Background()
+	first, second, db := setupLocks(t, sqliteLockDatabase(t), database.LockConfig{
+		TTL: 60 * time.Millisecond,
+	})
+
+	lease, err := first.TryAcquire(ctx)
+	require.NoError(t, err)
+
+	// Renewals keep the lease past its TTL
+	time.Sleep(150 * time.Millisecond)
+	require.NoError(t, lease.Context().Err())
+	_, err = second.TryAcquire(ctx)
+	require.ErrorIs(t, err, database.ErrLockHeld)
+
+	// Another process taking over the lease is noticed on the next renewal
+	_, err = db.Exec(`UPDATE database_locks SET owner = 'other', token = token + 1`)
+	require.NoError(t, err)
+
+	select {
+	case <-lease.Context().Done():
+		require.ErrorIs(t, context.Cause(lease.Context()), database.ErrLockLost)
+	case <-time.After(time.Second):
+		t.Fatal("expected the lease to be lost")
+	}
+	require.NoError(t, lease.Release(ctx))
+}
+
+func TestLock_ConnectionKilled(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short flag enabled")
+	}
+
+	t.Run("mysql", func(t *testing.T) {
+		config := mysqlLockDatabase(t)
+		testLockConnectionKilled(t, config, func(db *sql.DB) error {
+			var id int64
+			if err := db.QueryRow(`SELECT IS_USED_LOCK(?)`, config.DatabaseName+".jobs").Scan(&id); err != nil {
+				return err
+			}
+			_, err := db.Exec(fmt.Sprintf("KILL %d", id))
+			return err
+		})
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		testLockConnectionKilled(t, postgresLockDatabase(t), func(db *sql.DB) error {
+			_, err := db.Exec(`SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND granted
+AND database = (SELECT oid FROM pg_database WHERE datname = current_database())`)
+			return err
+		})
+	})
+}
+
+// testLockConnectionKilled checks a session lock is renewed while its connection holds it and lost
+// once kill closes that connection.
+func testLockConnectionKilled(t *testing.T, config database.DatabaseConfig, kill func(db *sql.DB) error) {
+	t.Helper()
+
+	ctx := context.Background()
+	first, second, db := setupLocks(t, config, database.LockConfig{
+		TTL: 150 * time.Millisecond,
+	})
+
+	lease, err := first.TryAcquire(ctx)
+	require.NoError(t, err)
+
+	// Renewals find the lock held by the lease's connection
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, lease.Context().Err())
+
+	require.NoError(t, kill(db))
+
+	select {
+	case <-lease.Context().Done():
+		require.ErrorIs(t, context.Cause(lease.Context()), database.ErrLockLost)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the lease to be lost")
+	}
+	lease.Release(ctx)
+
+	next, err := second.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), next.Token())
+	require.NoError(t, next.Release(ctx))
+}
+
+func TestLeaderElection(t *testing.T) {
+	first, second, _ := setupLocks(t, sqliteLockDatabase(t), database.LockConfig{
+		TTL:           time.Second,
+		RetryInterval: 10 * time.Millisecond,
+	})
+
+	firstElection := database.NewLeaderElection(log.NewTestLogger(), first)
+	secondElection := database.NewLeaderElection(log.NewTestLogger(), second)
+	require.ErrorContains(t, firstElection.ReadinessCheck(false)(), "has not started")
+
+	var leaders atomic.Int32
+	lead := func(ctx context.Context) {
+		require.Equal(t, int32(1), leaders.Add(1), "only one leader at a time")
+		defer leaders.Add(-1)
+		<-ctx.Done()
+	}
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error)
+	go func() { firstDone <- firstElection.Run(firstCtx, lead) }()
+
+	require.Eventually(t, firstElection.IsLeader, time.Second, 5*time.Millisecond)
+	token, leader := firstElection.Token()
+	require.True(t, leader)
+	require.Equal(t, int64(1), token)
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	secondDone := make(chan error)
+	go func() { secondDone <- secondElection.Run(secondCtx, lead) }()
+
+	require.Eventually(t, func() bool { return secondElection.ReadinessCheck(false)() == nil }, time.Second, 5*time.Millisecond)
+	require.EqualError(t, secondElection.ReadinessCheck(true)(), "not the leader")
+	require.NoError(t, firstElection.ReadinessCheck(true)())
+	require.False(t, secondElection.IsLeader())
+
+	// Leadership moves over when the leader stops
+	stopFirst()
+	require.NoError(t, <-firstDone)
+	require.False(t, firstElection.IsLeader())
+
+	require.Eventually(t, secondElection.IsLeader, time.Second, 5*time.Millisecond)
+	token, _ = secondElection.Token()
+	require.Equal(t, int64(2), token)
+
+	stopSecond()
+	require.NoError(t, <-secondDone)
+	require.Equal(t, int32(0), leaders.Load())
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// NewFSSource reads migrations from dir within fsys. Files named {version}_{title}.up.{database}.sql
+// are always included while the generic {version}_{title}.up.sql files are only included when
+// allowGeneric is true.
+func NewFSSource(fsys fs.FS, dir string, database string, allowGeneric bool) (source.Driver, error) {
+	dir = strings.Trim(dir, "/")
+
+	keep := migrationFilter(database, allowGeneric)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading the migrations directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, err := keep(entry.Name()); err != nil {
+			return nil, fmt.Errorf("walking the migrations directory: %w", err)
+		}
+	}
+
+	drv, err := iofs.New(&filteredFS{FS: fsys, dir: dir, keep: keep}, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate driver - %w", err)
+	}
+	return drv, nil
+}
+
+// WithMigrationsFS reads migrations from the migrations directory of f instead of the files packed
+// by pkger and selects the files for the configured database.
+func WithMigrationsFS(f fs.FS) MigrateOption {
+	return func(o *migrateOptions) error {
+		o.migrationsFS = f
+		return nil
+	}
+}
+
+// migrationFilter returns a function reporting if a migration file should be run against database.
+func migrationFilter(database string, allowGeneric bool) func(name string) (bool, error) {
+	database = strings.ToLower(database)
+
+	return func(name string) (bool, error) {
+		splits := strings.Split(name, ".")
+		slen := len(splits)
+		if slen < 3 {
+			return false, fmt.Errorf("doesn't follow format of {version}_{title}.up{.db}?.sql - %s", name)
+		}
+
+		if splits[slen-1] != "sql" {
+			return false, fmt.Errorf("must end in .sql")
+		}
+
+		switch splits[slen-2] {
+		case "up", "down":
+			return allowGeneric, nil
+		case database:
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+// filteredFS hides the files in dir which don't match keep.
+type filteredFS struct {
+	fs.FS
+	dir  string
+	keep func(name string) (bool, error)
+}
+
+func (f *filteredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil || path.Clean(name) != path.Clean(f.dir) {
+		return entries, err
+	}
+
+	out := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if ok, _ := f.keep(entry.Name()); ok {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
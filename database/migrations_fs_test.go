@@ -0,0 +1,72 @@
+package database
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFSSource(t *testing.T) {
+	fsys := os.DirFS("..")
+
+	cases := []struct {
+		database     string
+		allowGeneric bool
+		expected     []string
+	}{
+		{"mysql", true, []string{"001_create_tests.up.sql", "002_create_tests.up.mysql.sql"}},
+		{"MySQL", false, []string{"002_create_tests.up.mysql.sql"}},
+		{"postgres", false, []string{"002_create_tests.up.postgres.sql"}},
+		{"spanner", false, []string{"002_create_tests.up.spanner.sql"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.database, func(t *testing.T) {
+			src, err := NewFSSource(fsys, "/migrations/", tc.database, tc.allowGeneric)
+			require.NoError(t, err)
+			defer src.Close()
+
+			filtered := &filteredFS{FS: fsys, dir: "migrations", keep: migrationFilter(tc.database, tc.allowGeneric)}
+			entries, err := fs.ReadDir(filtered, "migrations")
+			require.NoError(t, err)
+
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			require.Equal(t, tc.expected, names)
+
+			first, err := src.First()
+			require.NoError(t, err)
+			if tc.allowGeneric {
+				require.Equal(t, uint(1), first)
+			} else {
+				require.Equal(t, uint(2), first)
+			}
+		})
+	}
+}
+
+func TestNewFSSource_InvalidNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_create.up.sql": &fstest.MapFile{Data: []byte("SELECT 1;")},
+		"migrations/README":            &fstest.MapFile{Data: []byte("notes")},
+	}
+	_, err := NewFSSource(fsys, "migrations", "mysql", true)
+	require.ErrorContains(t, err, "doesn't follow format")
+}
+
+func TestMigrationSource(t *testing.T) {
+	o := &migrateOptions{}
+	require.NoError(t, WithMigrationsFS(os.DirFS(".."))(o))
+
+	src, err := migrationSource(o, "postgres", false)
+	require.NoError(t, err)
+	require.Equal(t, "fs-postgres", src.name)
+
+	first, err := src.First()
+	require.NoError(t, err)
+	require.Equal(t, uint(2), first)
+}
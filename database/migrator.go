@@ -7,6 +7,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"io/fs"
 	"time"
 
@@ -29,26 +30,46 @@ func RunMigrations(logger log.Logger, config DatabaseConfig, opts ...MigrateOpti
 }
 
 func RunMigrationsContext(ctx context.Context, logger log.Logger, config DatabaseConfig, opts ...MigrateOption) error {
-	_, span := telemetry.StartSpan(ctx, "run-migrations", trace.WithAttributes(
+	ctx, span := telemetry.StartSpan(ctx, "run-migrations", trace.WithAttributes(
 		attribute.String("db.database_name", config.DatabaseName),
 	))
 	defer span.End()
 
 	logger.Info().Log("Running Migrations")
 
+	return runMigrate(ctx, logger, config, opts, span, func(m *migrate.Migrate) error {
+		return m.Up()
+	}, func(src source.Driver, current uint) ([]plannedMigration, error) {
+		return planUp(src, current, nil)
+	})
+}
+
+// newMigrate applies opts and returns a migrate.Migrate reading from the source and writing to
+// the driver returned by getDriver. Callers must close o.driver when finished.
+func newMigrate(ctx context.Context, logger log.Logger, config DatabaseConfig, opts []MigrateOption) (*migrate.Migrate, *migrateOptions, error) {
 	// apply all of our optional arguments
 	o := &migrateOptions{}
 	for _, opt := range opts {
 		if err := opt(o); err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 
 	source, driver, err := getDriver(logger, config, o)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if len(o.goMigrations) > 0 {
+		source, driver, err = withGoMigrations(ctx, logger, config, o)
+		if err != nil {
+			o.driver.Close()
+			return nil, nil, err
+		}
+	}
+	if config.MySQL != nil {
+		driver = withOnlineSchemaChanges(ctx, logger, config, o)
 	}
-	defer driver.Close()
 
 	m, err := migrate.NewWithInstance(
 		source.name,
@@ -57,48 +78,15 @@ func RunMigrationsContext(ctx context.Context, logger log.Logger, config Databas
 		driver,
 	)
 	if err != nil {
-		return logger.Fatal().LogErrorf("Error running migration: %w", err).Err()
+		driver.Close()
+		return nil, nil, logger.Fatal().LogErrorf("Error running migration: %w", err).Err()
 	}
 
 	if o.timeout != nil {
 		m.LockTimeout = *o.timeout
 	}
 
-	previousVersion, dirty, err := m.Version()
-	if err != nil {
-		if err != migrate.ErrNilVersion {
-			return logger.Fatal().LogErrorf("Error getting current DB version: %w", err).Err()
-		}
-		// set sane values
-		previousVersion = 0
-		dirty = false
-	}
-	span.SetAttributes(attribute.Int64("db.previous_version", int64(previousVersion)))
-
-	err = m.Up()
-
-	switch err {
-	case nil:
-	case migrate.ErrNoChange:
-		logger.Info().Logf("Database already at version %d (dirty: %v)", previousVersion, dirty)
-	default:
-		return logger.Fatal().LogErrorf("Error running migrations (current: %d, dirty: %v): %w", previousVersion, dirty, err).Err()
-	}
-
-	newVersion, newDirty, err := m.Version()
-	if err != nil {
-		if err != migrate.ErrNilVersion {
-			return logger.Fatal().LogErrorf("Error getting new DB version: %w", err).Err()
-		}
-		// set sane values
-		newVersion = 0
-		newDirty = false
-	}
-	span.SetAttributes(attribute.Int64("db.new_version", int64(newVersion)))
-
-	logger.Info().Logf("Migrations complete: previous: %d (dirty:%v) -> new: %d (dirty:%v)", previousVersion, dirty, newVersion, newDirty)
-
-	return nil
+	return m, o, nil
 }
 
 // Deprecated: Here to not break compatibility since it was once public.
@@ -111,14 +99,10 @@ func getDriver(logger log.Logger, config DatabaseConfig, opts *migrateOptions) (
 
 	if config.MySQL != nil {
 		if opts.source == nil {
-			src, err := NewPkgerSource("mysql", true)
+			opts.source, err = migrationSource(opts, "mysql", true)
 			if err != nil {
 				return nil, nil, err
 			}
-			opts.source = &SourceDriver{
-				name:   "pkger-mysql",
-				Driver: src,
-			}
 		}
 
 		if opts.driver == nil {
@@ -135,14 +119,10 @@ func getDriver(logger log.Logger, config DatabaseConfig, opts *migrateOptions) (
 
 	} else if config.Spanner != nil {
 		if opts.source == nil {
-			src, err := NewPkgerSource("spanner", false)
+			opts.source, err = migrationSource(opts, "spanner", false)
 			if err != nil {
 				return nil, nil, err
 			}
-			opts.source = &SourceDriver{
-				name:   "pkger-spanner",
-				Driver: src,
-			}
 		}
 
 		if opts.driver == nil {
@@ -153,14 +133,10 @@ func getDriver(logger log.Logger, config DatabaseConfig, opts *migrateOptions) (
 		}
 	} else if config.Postgres != nil {
 		if opts.source == nil {
-			src, err := NewPkgerSource("postgres", false)
+			opts.source, err = migrationSource(opts, "postgres", false)
 			if err != nil {
 				return nil, nil, err
 			}
-			opts.source = &SourceDriver{
-				name:   "pkger-postgres",
-				Driver: src,
-			}
 		}
 
 		if opts.driver == nil {
@@ -174,6 +150,25 @@ func getDriver(logger log.Logger, config DatabaseConfig, opts *migrateOptions) (
 				return nil, nil, err
 			}
 		}
+	} else if config.SQLite != nil {
+		if opts.source == nil {
+			opts.source, err = migrationSource(opts, "sqlite", true)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if opts.driver == nil {
+			db, err := New(context.Background(), logger, config)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			opts.driver, err = SQLiteDriver(db)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
 	}
 
 	if opts.source == nil || opts.driver == nil {
@@ -183,6 +178,29 @@ func getDriver(logger log.Logger, config DatabaseConfig, opts *migrateOptions) (
 	return opts.source, opts.driver, nil
 }
 
+// migrationSource reads from the fs.FS given with WithMigrationsFS, falling back to pkger.
+func migrationSource(opts *migrateOptions, database string, allowGeneric bool) (*SourceDriver, error) {
+	if opts.migrationsFS != nil {
+		src, err := NewFSSource(opts.migrationsFS, "migrations", database, allowGeneric)
+		if err != nil {
+			return nil, err
+		}
+		return &SourceDriver{
+			name:   "fs-" + database,
+			Driver: src,
+		}, nil
+	}
+
+	src, err := NewPkgerSource(database, allowGeneric)
+	if err != nil {
+		return nil, err
+	}
+	return &SourceDriver{
+		name:   "pkger-" + database,
+		Driver: src,
+	}, nil
+}
+
 func MySQLDriver(db *sql.DB) (database.Driver, error) {
 	return migmysql.WithInstance(db, &migmysql.Config{})
 }
@@ -203,10 +221,17 @@ type SourceDriver struct {
 }
 
 type migrateOptions struct {
-	source *SourceDriver
-	driver database.Driver
+	source       *SourceDriver
+	migrationsFS fs.FS
+	driver       database.Driver
+	goMigrations map[uint]GoMigration
+	embeddedFS   fs.FS
+	lint         *LintMode
+
+	onlineSchemaChanges *OnlineSchemaChangeConfig
 
 	timeout *time.Duration
+	dryRun  io.Writer
 }
 
 func WithEmbeddedMigrations(f fs.FS) MigrateOption {
@@ -219,6 +244,7 @@ func WithEmbeddedMigrations(f fs.FS) MigrateOption {
 			name:   "embedded",
 			Driver: src,
 		}
+		o.embeddedFS = f
 		return nil
 	}
 }
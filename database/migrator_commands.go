@@ -0,0 +1,370 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/telemetry"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Migration is a single migration read from the migration source.
+type Migration struct {
+	Version    uint
+	Identifier string
+}
+
+// MigrationState describes which migrations have been applied to a database.
+type MigrationState struct {
+	// Version is the last applied migration, or zero when none have been applied.
+	Version uint
+
+	// Dirty is true when a migration failed part way through. The schema needs to be repaired
+	// by hand and the version set with ForceVersion before migrations can run again.
+	Dirty bool
+
+	Applied []Migration
+	Pending []Migration
+}
+
+// MigrateTo runs the up or down migrations needed to move the database to version.
+func MigrateTo(ctx context.Context, logger log.Logger, config DatabaseConfig, version uint, opts ...MigrateOption) error {
+	ctx, span := telemetry.StartSpan(ctx, "migrate-to", trace.WithAttributes(
+		attribute.String("db.database_name", config.DatabaseName),
+		attribute.Int64("db.target_version", int64(version)),
+	))
+	defer span.End()
+
+	logger.Info().Logf("Migrating to version %d", version)
+
+	return runMigrate(ctx, logger, config, opts, span, func(m *migrate.Migrate) error {
+		return m.Migrate(version)
+	}, func(src source.Driver, current uint) ([]plannedMigration, error) {
+		if version >= current {
+			return planUp(src, current, &version)
+		}
+		return planDown(src, current, func(v uint, _ int) bool { return v <= version }, &version)
+	})
+}
+
+// MigrateDown runs the down migrations of the last steps applied migrations.
+func MigrateDown(ctx context.Context, logger log.Logger, config DatabaseConfig, steps int, opts ...MigrateOption) error {
+	ctx, span := telemetry.StartSpan(ctx, "migrate-down", trace.WithAttributes(
+		attribute.String("db.database_name", config.DatabaseName),
+		attribute.Int("db.steps", steps),
+	))
+	defer span.End()
+
+	if steps <= 0 {
+		return fmt.Errorf("migrate down steps must be positive: %d", steps)
+	}
+
+	logger.Info().Logf("Rolling back %d migrations", steps)
+
+	return runMigrate(ctx, logger, config, opts, span, func(m *migrate.Migrate) error {
+		return m.Steps(-steps)
+	}, func(src source.Driver, current uint) ([]plannedMigration, error) {
+		migrations, err := planDown(src, current, func(_ uint, n int) bool { return n >= steps }, nil)
+		if err == nil && len(migrations) < steps {
+			err = fmt.Errorf("only %d of %d migrations can be rolled back", len(migrations), steps)
+		}
+		return migrations, err
+	})
+}
+
+// ForceVersion sets the version recorded in the database and clears the dirty flag without running
+// any migrations. It's used after repairing a failed migration by hand. A version of -1 records
+// that no migrations have been applied.
+func ForceVersion(ctx context.Context, logger log.Logger, config DatabaseConfig, version int, opts ...MigrateOption) error {
+	ctx, span := telemetry.StartSpan(ctx, "force-migration-version", trace.WithAttributes(
+		attribute.String("db.database_name", config.DatabaseName),
+		attribute.Int("db.new_version", version),
+	))
+	defer span.End()
+
+	m, o, err := newMigrate(ctx, logger, config, opts)
+	if err != nil {
+		return err
+	}
+	defer o.driver.Close()
+
+	previousVersion, dirty, err := currentVersion(m)
+	if err != nil {
+		return logger.Fatal().LogErrorf("Error getting current DB version: %w", err).Err()
+	}
+	span.SetAttributes(attribute.Int64("db.previous_version", int64(previousVersion)))
+
+	if o.dryRun != nil {
+		_, err := fmt.Fprintf(o.dryRun, "-- force version %d (current: %d, dirty: %v)\n", version, previousVersion, dirty)
+		return err
+	}
+
+	if err := m.Force(version); err != nil {
+		return logger.Fatal().LogErrorf("Error forcing version %d (current: %d, dirty: %v): %w", version, previousVersion, dirty, err).Err()
+	}
+
+	logger.Info().Logf("Forced version: previous: %d (dirty:%v) -> new: %d", previousVersion, dirty, version)
+
+	return nil
+}
+
+// MigrationStatus reports the current version of the database along with the applied and pending
+// migrations from the source.
+func MigrationStatus(ctx context.Context, logger log.Logger, config DatabaseConfig, opts ...MigrateOption) (*MigrationState, error) {
+	ctx, span := telemetry.StartSpan(ctx, "migration-status", trace.WithAttributes(
+		attribute.String("db.database_name", config.DatabaseName),
+	))
+	defer span.End()
+
+	m, o, err := newMigrate(ctx, logger, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer o.driver.Close()
+
+	version, dirty, err := currentVersion(m)
+	if err != nil {
+		return nil, logger.Fatal().LogErrorf("Error getting current DB version: %w", err).Err()
+	}
+	span.SetAttributes(
+		attribute.Int64("db.previous_version", int64(version)),
+		attribute.Bool("db.dirty", dirty),
+	)
+
+	migrations, err := planUp(o.source, 0, nil)
+	if err != nil {
+		return nil, logger.Fatal().LogErrorf("Error reading migrations: %w", err).Err()
+	}
+
+	state := &MigrationState{
+		Version: version,
+		Dirty:   dirty,
+	}
+	for _, mig := range migrations {
+		if version > 0 && mig.Version <= version {
+			state.Applied = append(state.Applied, mig.Migration)
+		} else {
+			state.Pending = append(state.Pending, mig.Migration)
+		}
+	}
+	return state, nil
+}
+
+// WithDryRun writes the SQL of each migration that would run to w instead of applying them.
+func WithDryRun(w io.Writer) MigrateOption {
+	return func(o *migrateOptions) error {
+		o.dryRun = w
+		return nil
+	}
+}
+
+// runMigrate runs a migration command against the database, recording the versions before and after
+// on span. With WithDryRun the planned migrations are written out instead.
+func runMigrate(
+	ctx context.Context,
+	logger log.Logger,
+	config DatabaseConfig,
+	opts []MigrateOption,
+	span trace.Span,
+	run func(m *migrate.Migrate) error,
+	plan func(src source.Driver, current uint) ([]plannedMigration, error),
+) error {
+	m, o, err := newMigrate(ctx, logger, config, opts)
+	if err != nil {
+		return err
+	}
+	defer o.driver.Close()
+
+	previousVersion, dirty, err := currentVersion(m)
+	if err != nil {
+		return logger.Fatal().LogErrorf("Error getting current DB version: %w", err).Err()
+	}
+	span.SetAttributes(attribute.Int64("db.previous_version", int64(previousVersion)))
+
+	if o.dryRun != nil && dirty {
+		return fmt.Errorf("database is dirty at version %d", previousVersion)
+	}
+
+	var planned []plannedMigration
+	if o.lint != nil || o.dryRun != nil {
+		planned, err = plan(o.source, previousVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.lint != nil {
+		if err := lintMigrations(logger, config, o, planned); err != nil {
+			return err
+		}
+	}
+
+	if o.dryRun != nil {
+		return writePlan(o.dryRun, planned)
+	}
+
+	err = run(m)
+
+	switch err {
+	case nil:
+	case migrate.ErrNoChange:
+		logger.Info().Logf("Database already at version %d (dirty: %v)", previousVersion, dirty)
+	default:
+		return logger.Fatal().LogErrorf("Error running migrations (current: %d, dirty: %v): %w", previousVersion, dirty, err).Err()
+	}
+
+	newVersion, newDirty, err := currentVersion(m)
+	if err != nil {
+		return logger.Fatal().LogErrorf("Error getting new DB version: %w", err).Err()
+	}
+	span.SetAttributes(attribute.Int64("db.new_version", int64(newVersion)))
+
+	logger.Info().Logf("Migrations complete: previous: %d (dirty:%v) -> new: %d (dirty:%v)", previousVersion, dirty, newVersion, newDirty)
+
+	return nil
+}
+
+// currentVersion returns the version of the database, using zero when no migrations have been applied.
+func currentVersion(m *migrate.Migrate) (uint, bool, error) {
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		// set sane values
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+type plannedMigration struct {
+	Migration
+
+	direction string
+	sql       []byte
+}
+
+// planUp returns the up migrations after current, stopping at target when it's not nil.
+func planUp(src source.Driver, current uint, target *uint) ([]plannedMigration, error) {
+	var out []plannedMigration
+	for {
+		if target != nil && current == *target {
+			return out, nil
+		}
+
+		var next uint
+		var err error
+		if current == 0 && len(out) == 0 {
+			next, err = src.First()
+		} else {
+			next, err = src.Next(current)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			if target != nil {
+				return nil, fmt.Errorf("migration version %d not found", *target)
+			}
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if target != nil && next > *target {
+			return nil, fmt.Errorf("migration version %d not found", *target)
+		}
+
+		r, identifier, err := src.ReadUp(next)
+		if err != nil {
+			return nil, fmt.Errorf("reading up migration %d: %w", next, err)
+		}
+		mig, err := readPlanned(next, identifier, "up", r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, mig)
+		current = next
+	}
+}
+
+// planDown returns the down migrations from current until done reports true for the version
+// reached and the number of migrations planned. A non-nil target must be a known version.
+func planDown(src source.Driver, current uint, done func(version uint, steps int) bool, target *uint) ([]plannedMigration, error) {
+	var out []plannedMigration
+	for current > 0 && !done(current, len(out)) {
+		mig := plannedMigration{
+			Migration: Migration{Version: current},
+			direction: "down",
+		}
+		r, identifier, err := src.ReadDown(current)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// golang-migrate only records the version change without a down file
+		case err != nil:
+			return nil, fmt.Errorf("reading down migration %d: %w", current, err)
+		default:
+			mig, err = readPlanned(current, identifier, "down", r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, mig)
+
+		prev, err := src.Prev(current)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			current = 0
+		case err != nil:
+			return nil, err
+		default:
+			current = prev
+		}
+	}
+	if target != nil && (*target != current || current == 0) {
+		return nil, fmt.Errorf("migration version %d not found", *target)
+	}
+	return out, nil
+}
+
+func readPlanned(version uint, identifier, direction string, r io.ReadCloser) (plannedMigration, error) {
+	defer r.Close()
+
+	sql, err := io.ReadAll(r)
+	if err != nil {
+		return plannedMigration{}, fmt.Errorf("reading %s migration %d: %w", direction, version, err)
+	}
+	return plannedMigration{
+		Migration: Migration{
+			Version:    version,
+			Identifier: identifier,
+		},
+		direction: direction,
+		sql:       sql,
+	}, nil
+}
+
+func writePlan(w io.Writer, migrations []plannedMigration) error {
+	if len(migrations) == 0 {
+		_, err := fmt.Fprintln(w, "-- no migrations to run")
+		return err
+	}
+	for _, mig := range migrations {
+		var err error
+		if mig.sql == nil {
+			_, err = fmt.Fprintf(w, "-- %d %s: no migration file\n\n", mig.Version, mig.direction)
+		} else {
+			_, err = fmt.Fprintf(w, "-- %d_%s.%s\n%s\n\n", mig.Version, mig.Identifier, mig.direction, mig.sql)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+var commandMigrations = fstest.MapFS{
+	"migrations/001_create_a.up.sql":     {Data: []byte("CREATE TABLE a (id TEXT);")},
+	"migrations/001_create_a.down.sql":   {Data: []byte("DROP TABLE a;")},
+	"migrations/002_create_b.up.sql":     {Data: []byte("CREATE TABLE b (id TEXT);")},
+	"migrations/002_create_b.down.sql":   {Data: []byte("DROP TABLE b;")},
+	"migrations/003_add_c.up.sqlite.sql": {Data: []byte("ALTER TABLE b ADD COLUMN c TEXT;")},
+}
+
+func TestMigrationCommands(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewTestLogger()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	opts := []database.MigrateOption{database.WithMigrationsFS(commandMigrations)}
+	status := func() *database.MigrationState {
+		t.Helper()
+		state, err := database.MigrationStatus(ctx, logger, config, opts...)
+		require.NoError(t, err)
+		return state
+	}
+
+	state := status()
+	require.Equal(t, uint(0), state.Version)
+	require.False(t, state.Dirty)
+	require.Empty(t, state.Applied)
+	require.Equal(t, []database.Migration{
+		{Version: 1, Identifier: "create_a"},
+		{Version: 2, Identifier: "create_b"},
+		{Version: 3, Identifier: "add_c"},
+	}, state.Pending)
+
+	// Dry runs list the SQL without applying it
+	var buf bytes.Buffer
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, append(opts, database.WithDryRun(&buf))...))
+	require.Equal(t, "-- 1_create_a.up\nCREATE TABLE a (id TEXT);\n\n"+
+		"-- 2_create_b.up\nCREATE TABLE b (id TEXT);\n\n"+
+		"-- 3_add_c.up\nALTER TABLE b ADD COLUMN c TEXT;\n\n", buf.String())
+	require.Equal(t, uint(0), status().Version)
+
+	// Migrate up to a version
+	require.NoError(t, database.MigrateTo(ctx, logger, config, 2, opts...))
+	state = status()
+	require.Equal(t, uint(2), state.Version)
+	require.Len(t, state.Applied, 2)
+	require.Len(t, state.Pending, 1)
+
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, opts...))
+	require.Equal(t, uint(3), status().Version)
+
+	buf.Reset()
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, append(opts, database.WithDryRun(&buf))...))
+	require.Equal(t, "-- no migrations to run\n", buf.String())
+
+	// Roll back
+	buf.Reset()
+	require.NoError(t, database.MigrateDown(ctx, logger, config, 2, append(opts, database.WithDryRun(&buf))...))
+	require.Equal(t, "-- 3 down: no migration file\n\n-- 2_create_b.down\nDROP TABLE b;\n\n", buf.String())
+	require.Equal(t, uint(3), status().Version)
+
+	require.NoError(t, database.MigrateDown(ctx, logger, config, 2, opts...))
+	require.Equal(t, uint(1), status().Version)
+
+	buf.Reset()
+	require.NoError(t, database.MigrateTo(ctx, logger, config, 3, append(opts, database.WithDryRun(&buf))...))
+	require.Contains(t, buf.String(), "-- 2_create_b.up\n")
+	require.Contains(t, buf.String(), "-- 3_add_c.up\n")
+
+	// Invalid targets
+	require.ErrorContains(t, database.MigrateTo(ctx, logger, config, 5, append(opts, database.WithDryRun(&buf))...), "migration version 5 not found")
+	require.Error(t, database.MigrateTo(ctx, logger, config, 5, opts...))
+	require.ErrorContains(t, database.MigrateDown(ctx, logger, config, 2, append(opts, database.WithDryRun(&buf))...), "only 1 of 2 migrations")
+	require.Error(t, database.MigrateDown(ctx, logger, config, 0, opts...))
+	require.Equal(t, uint(1), status().Version)
+
+	// Force the version
+	require.NoError(t, database.ForceVersion(ctx, logger, config, 2, opts...))
+	require.Equal(t, uint(2), status().Version)
+
+	require.NoError(t, database.ForceVersion(ctx, logger, config, -1, opts...))
+	state = status()
+	require.Equal(t, uint(0), state.Version)
+	require.Len(t, state.Pending, 3)
+}
+
+func TestMigrationCommands_Dirty(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewTestLogger()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	opts := []database.MigrateOption{database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id TEXT);")},
+		"migrations/002_broken.up.sql":   {Data: []byte("CREATE TABLE a (id TEXT);")},
+	})}
+
+	require.Error(t, database.RunMigrationsContext(ctx, logger, config, opts...))
+
+	state, err := database.MigrationStatus(ctx, logger, config, opts...)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), state.Version)
+	require.True(t, state.Dirty)
+
+	var buf bytes.Buffer
+	require.ErrorContains(t, database.RunMigrationsContext(ctx, logger, config, append(opts, database.WithDryRun(&buf))...), "database is dirty at version 2")
+
+	require.NoError(t, database.ForceVersion(ctx, logger, config, 1, opts...))
+	state, err = database.MigrationStatus(ctx, logger, config, opts...)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), state.Version)
+	require.False(t, state.Dirty)
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+
+	"github.com/moov-io/base/log"
+)
+
+// GoMigration is a migration written in Go which runs between the SQL migrations by version.
+// Up (and Down when set) are called in a transaction and the version is recorded in the same
+// table as the SQL migrations.
+type GoMigration struct {
+	Version uint
+	Name    string
+
+	Up   func(ctx context.Context, tx *sql.Tx) error
+	Down func(ctx context.Context, tx *sql.Tx) error
+}
+
+// WithGoMigrations adds migrations written in Go to the SQL migrations read from the source.
+// Versions must be unique across both the Go and SQL migrations.
+func WithGoMigrations(migrations ...GoMigration) MigrateOption {
+	return func(o *migrateOptions) error {
+		if o.goMigrations == nil {
+			o.goMigrations = make(map[uint]GoMigration)
+		}
+		for _, m := range migrations {
+			if m.Version == 0 {
+				return fmt.Errorf("go migration %q has no version", m.Name)
+			}
+			if m.Up == nil {
+				return fmt.Errorf("go migration %d has no Up function", m.Version)
+			}
+			if _, exists := o.goMigrations[m.Version]; exists {
+				return fmt.Errorf("duplicate go migration version %d", m.Version)
+			}
+			o.goMigrations[m.Version] = m
+		}
+		return nil
+	}
+}
+
+// goMigrationMarker starts the body of Go migrations read from a goSource, which goDriver
+// recognizes and runs instead of passing the body to the database.
+const goMigrationMarker = "-- go migration "
+
+// withGoMigrations wraps the source and driver in o so that the Go migrations run in order
+// with the SQL migrations.
+func withGoMigrations(ctx context.Context, logger log.Logger, config DatabaseConfig, o *migrateOptions) (*SourceDriver, database.Driver, error) {
+	src, err := newGoSource(o.source.Driver, o.goMigrations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Migration drivers can hold a connection (and the migration lock) for as long as they're open,
+	// so the Go migrations use their own connections.
+	db, err := New(ctx, logger, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	drv := &goDriver{
+		Driver:     o.driver,
+		ctx:        ctx,
+		db:         db,
+		migrations: o.goMigrations,
+	}
+
+	o.source = &SourceDriver{
+		name:   o.source.name,
+		Driver: src,
+	}
+	o.driver = drv
+
+	return o.source, o.driver, nil
+}
+
+// goSource lists the Go migrations alongside the versions of the underlying source.
+type goSource struct {
+	source.Driver
+
+	versions   []uint
+	migrations map[uint]GoMigration
+}
+
+func newGoSource(underlying source.Driver, migrations map[uint]GoMigration) (*goSource, error) {
+	var versions []uint
+
+	v, err := underlying.First()
+	for err == nil {
+		if m, exists := migrations[v]; exists {
+			return nil, fmt.Errorf("go migration %d (%s) has the same version as a SQL migration", v, m.Name)
+		}
+		versions = append(versions, v)
+		v, err = underlying.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for v := range migrations {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return &goSource{
+		Driver:     underlying,
+		versions:   versions,
+		migrations: migrations,
+	}, nil
+}
+
+func (s *goSource) First() (uint, error) {
+	if len(s.versions) == 0 {
+		return 0, os.ErrNotExist
+	}
+	return s.versions[0], nil
+}
+
+func (s *goSource) Prev(version uint) (uint, error) {
+	idx := s.index(version)
+	if idx <= 0 {
+		return 0, os.ErrNotExist
+	}
+	return s.versions[idx-1], nil
+}
+
+func (s *goSource) Next(version uint) (uint, error) {
+	idx := s.index(version)
+	if idx < 0 || idx+1 >= len(s.versions) {
+		return 0, os.ErrNotExist
+	}
+	return s.versions[idx+1], nil
+}
+
+func (s *goSource) index(version uint) int {
+	idx := sort.Search(len(s.versions), func(i int) bool { return s.versions[i] >= version })
+	if idx < len(s.versions) && s.versions[idx] == version {
+		return idx
+	}
+	return -1
+}
+
+func (s *goSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if m, exists := s.migrations[version]; exists {
+		return goMigrationBody(m, "up"), m.Name, nil
+	}
+	return s.Driver.ReadUp(version)
+}
+
+func (s *goSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if m, exists := s.migrations[version]; exists {
+		if m.Down == nil {
+			return nil, "", os.ErrNotExist
+		}
+		return goMigrationBody(m, "down"), m.Name, nil
+	}
+	return s.Driver.ReadDown(version)
+}
+
+func goMigrationBody(m GoMigration, direction string) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(fmt.Sprintf("%s%d %s: %s", goMigrationMarker, m.Version, direction, m.Name)))
+}
+
+// goDriver runs Go migrations in a transaction and passes SQL migrations to the underlying driver.
+type goDriver struct {
+	database.Driver
+
+	ctx        context.Context
+	db         *sql.DB
+	migrations map[uint]GoMigration
+}
+
+func (d *goDriver) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(body, []byte(goMigrationMarker)) {
+		return d.Driver.Run(bytes.NewReader(body))
+	}
+
+	var version uint
+	var direction string
+	if _, err := fmt.Sscanf(string(body[len(goMigrationMarker):]), "%d %s", &version, &direction); err != nil {
+		return fmt.Errorf("reading go migration %q: %w", body, err)
+	}
+	direction = strings.TrimSuffix(direction, ":")
+
+	m, exists := d.migrations[version]
+	if !exists {
+		return fmt.Errorf("go migration %d not found", version)
+	}
+	fn := m.Up
+	if direction == "down" {
+		fn = m.Down
+	}
+
+	err = InTx(d.ctx, d.db, TxOptions{}, func(tx *sql.Tx) error {
+		return fn(d.ctx, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("go migration %d (%s) %s: %w", version, m.Name, direction, err)
+	}
+	return nil
+}
+
+func (d *goDriver) Close() error {
+	return errors.Join(d.Driver.Close(), d.db.Close())
+}
@@ -0,0 +1,140 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+func TestGoMigrations(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewTestLogger()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	var calls []string
+	opts := []database.MigrateOption{
+		database.WithMigrationsFS(fstest.MapFS{
+			"migrations/001_create_people.up.sql":    {Data: []byte("CREATE TABLE people (full_name TEXT, first TEXT, last TEXT);")},
+			"migrations/003_drop_full_name.up.sql":   {Data: []byte("ALTER TABLE people DROP COLUMN full_name;")},
+			"migrations/003_drop_full_name.down.sql": {Data: []byte("ALTER TABLE people ADD COLUMN full_name TEXT;")},
+		}),
+		database.WithGoMigrations(database.GoMigration{
+			Version: 2,
+			Name:    "split_names",
+			Up: func(ctx context.Context, tx *sql.Tx) error {
+				calls = append(calls, "up")
+
+				// Tables created by earlier SQL migrations are available
+				_, err := tx.ExecContext(ctx, `INSERT INTO people (full_name) VALUES ('Jane Doe')`)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `UPDATE people SET first = substr(full_name, 1, instr(full_name, ' ') - 1), last = substr(full_name, instr(full_name, ' ') + 1)`)
+				return err
+			},
+			Down: func(ctx context.Context, tx *sql.Tx) error {
+				calls = append(calls, "down")
+				_, err := tx.ExecContext(ctx, `DELETE FROM people`)
+				return err
+			},
+		}),
+	}
+
+	state, err := database.MigrationStatus(ctx, logger, config, opts...)
+	require.NoError(t, err)
+	require.Equal(t, []database.Migration{
+		{Version: 1, Identifier: "create_people"},
+		{Version: 2, Identifier: "split_names"},
+		{Version: 3, Identifier: "drop_full_name"},
+	}, state.Pending)
+
+	var buf bytes.Buffer
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, append(opts, database.WithDryRun(&buf))...))
+	require.Contains(t, buf.String(), "-- 2_split_names.up\n-- go migration 2 up: split_names\n")
+	require.Empty(t, calls)
+
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, opts...))
+	require.Equal(t, []string{"up"}, calls)
+
+	db, err := database.New(ctx, logger, config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var first, last string
+	require.NoError(t, db.QueryRow(`SELECT first, last FROM people`).Scan(&first, &last))
+	require.Equal(t, "Jane", first)
+	require.Equal(t, "Doe", last)
+
+	// Running again doesn't repeat the Go migration
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, opts...))
+	require.Equal(t, []string{"up"}, calls)
+
+	require.NoError(t, database.MigrateDown(ctx, logger, config, 2, opts...))
+	require.Equal(t, []string{"up", "down"}, calls)
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&count))
+	require.Equal(t, 0, count)
+}
+
+func TestGoMigrations_Errors(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewTestLogger()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	sqlMigrations := database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_items.up.sql": {Data: []byte("CREATE TABLE items (id TEXT);")},
+	})
+	noop := func(ctx context.Context, tx *sql.Tx) error { return nil }
+
+	// Versions can't be reused
+	err = database.RunMigrationsContext(ctx, logger, config, sqlMigrations, database.WithGoMigrations(database.GoMigration{Version: 1, Up: noop}))
+	require.ErrorContains(t, err, "same version as a SQL migration")
+
+	err = database.RunMigrationsContext(ctx, logger, config, sqlMigrations, database.WithGoMigrations(
+		database.GoMigration{Version: 2, Up: noop},
+		database.GoMigration{Version: 2, Up: noop},
+	))
+	require.ErrorContains(t, err, "duplicate go migration version 2")
+
+	err = database.RunMigrationsContext(ctx, logger, config, sqlMigrations, database.WithGoMigrations(database.GoMigration{Version: 2}))
+	require.ErrorContains(t, err, "has no Up function")
+
+	// Failed Go migrations roll back and leave the database dirty
+	err = database.RunMigrationsContext(ctx, logger, config, sqlMigrations, database.WithGoMigrations(database.GoMigration{
+		Version: 2,
+		Name:    "fails",
+		Up: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO items (id) VALUES ('a')`)
+			require.NoError(t, err)
+			return errors.New("bad data")
+		},
+	}))
+	require.ErrorContains(t, err, "bad data")
+
+	state, err := database.MigrationStatus(ctx, logger, config, sqlMigrations)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), state.Version)
+	require.True(t, state.Dirty)
+
+	db, err := database.New(ctx, logger, config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&count))
+	require.Equal(t, 0, count)
+}
@@ -0,0 +1,405 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/pkgerfs"
+)
+
+// Rules reported by AnalyzeMigrations. A migration file skips a rule with a comment such as
+// "-- lint:ignore destructive" when the statement is intended.
+const (
+	LintDestructive       = "destructive"
+	LintPostgresIndex     = "postgres-index"
+	LintMySQLLockingAlter = "mysql-locking-alter"
+	LintMissingDialect    = "missing-dialect"
+	LintVersionGap        = "version-gap"
+	LintDuplicateVersion  = "duplicate-version"
+)
+
+// MigrationIssue is a problem found in a migration before it's applied.
+type MigrationIssue struct {
+	File    string
+	Version uint
+	Rule    string
+	Message string
+}
+
+func (i MigrationIssue) Error() string {
+	if i.File == "" {
+		return fmt.Sprintf("migration %d: %s: %s", i.Version, i.Rule, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.File, i.Rule, i.Message)
+}
+
+// LintMode controls what happens when migrations have issues.
+type LintMode int
+
+const (
+	// LintWarn logs each issue and continues with the migrations.
+	LintWarn LintMode = iota
+
+	// LintFail logs each issue and stops before any migration runs.
+	LintFail
+)
+
+// WithMigrationLint analyzes the migrations with AnalyzeMigrations before they run. Only the up or
+// down files which are about to run are checked. Linting reads the files given with
+// WithEmbeddedMigrations or WithMigrationsFS, or the files packed by pkger without them.
+func WithMigrationLint(mode LintMode) MigrateOption {
+	return func(o *migrateOptions) error {
+		o.lint = &mode
+		return nil
+	}
+}
+
+// lintDialects are the databases which have their own migration files.
+var lintDialects = []string{"mysql", "postgres", "spanner", "sqlite"}
+
+// usesGeneric reports if a dialect also runs the {version}_{title}.up.sql files.
+func usesGeneric(dialect string) bool {
+	return dialect == "mysql" || dialect == "sqlite"
+}
+
+var (
+	migrationFilename = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)(?:\.([a-z0-9]+))?\.sql$`)
+	lintIgnore        = regexp.MustCompile(`(?i)--\s*lint:ignore\s+([a-z0-9, -]+)`)
+
+	destructiveStatement = regexp.MustCompile(`^(DROP\s+(TABLE|DATABASE|SCHEMA)\b|TRUNCATE\b|ALTER\s+TABLE\b.*\bDROP\s+(COLUMN\b|[^\s(]+\s*$|[^\s(]+\s*,))`)
+	createIndex          = regexp.MustCompile(`^CREATE\s+(UNIQUE\s+)?INDEX\b`)
+	concurrentIndex      = regexp.MustCompile(`^CREATE\s+(UNIQUE\s+)?INDEX\s+CONCURRENTLY\b`)
+	alterTable           = regexp.MustCompile(`^ALTER\s+TABLE\b`)
+	onlineAlter          = regexp.MustCompile(`\bALGORITHM\s*=\s*(INSTANT|INPLACE)\b|\bLOCK\s*=\s*NONE\b`)
+	sqlLineComment       = regexp.MustCompile(`--[^\n]*`)
+	sqlBlockComment      = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	sqlWhitespace        = regexp.MustCompile(`\s+`)
+)
+
+// timestampVersion is the smallest version treated as a timestamp (such as 20240102150405),
+// where gaps between versions are expected.
+const timestampVersion = 1_000_000_000
+
+type migrationFile struct {
+	name      string
+	version   uint
+	title     string
+	direction string
+	dialect   string
+}
+
+// AnalyzeMigrations checks the migration files in dir of fsys for statements that are unsafe to
+// run against a live database and for problems with how the files are versioned:
+//
+//   - destructive: up migrations dropping tables, columns or databases, or truncating tables
+//   - postgres-index: Postgres indexes created without CONCURRENTLY, which blocks writes
+//   - mysql-locking-alter: MySQL ALTER TABLE without ALGORITHM=INSTANT, ALGORITHM=INPLACE or LOCK=NONE
+//   - missing-dialect: a version with a file for one database but not the others in use
+//   - version-gap: sequential versions which skip a number
+//   - duplicate-version: versions with more than one title or file per database
+//
+// Issues are sorted by version. An error is only returned when the files can't be read.
+func AnalyzeMigrations(fsys fs.FS, dir string) ([]MigrationIssue, error) {
+	return analyzeMigrations(fsys, dir, "", nil, func(file migrationFile) bool {
+		return file.direction == "up"
+	})
+}
+
+// analyzeMigrations checks the statements of the files where lint returns true and the versions of every file.
+// Generic files are checked as migrations for dialect, or for every database when dialect is empty.
+func analyzeMigrations(fsys fs.FS, dir string, dialect string, extraVersions []uint, lint func(file migrationFile) bool) ([]MigrationIssue, error) {
+	dir = strings.Trim(dir, "/")
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading the migrations directory: %w", err)
+	}
+
+	var issues []MigrationIssue
+	var files []migrationFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := migrationFilename.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version of %s: %w", entry.Name(), err)
+		}
+		file := migrationFile{
+			name:      entry.Name(),
+			version:   uint(version),
+			title:     matches[2],
+			direction: matches[3],
+			dialect:   matches[4],
+		}
+		files = append(files, file)
+		if !lint(file) {
+			continue
+		}
+
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", entry.Name(), err)
+		}
+		issues = append(issues, lintStatements(file, dialect, string(contents))...)
+	}
+
+	issues = append(issues, lintVersions(files, extraVersions)...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Version < issues[j].Version
+	})
+	return issues, nil
+}
+
+// lintStatements checks each statement of a migration file run against dialect. Generic files are
+// checked for every database when dialect is empty.
+func lintStatements(file migrationFile, dialect string, contents string) []MigrationIssue {
+	if file.dialect != "" {
+		dialect = file.dialect
+	}
+
+	ignored := make(map[string]bool)
+	for _, m := range lintIgnore.FindAllStringSubmatch(contents, -1) {
+		for _, rule := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+			ignored[strings.ToLower(rule)] = true
+		}
+	}
+
+	var issues []MigrationIssue
+	add := func(rule, message string) {
+		if !ignored[rule] {
+			issues = append(issues, MigrationIssue{File: file.name, Version: file.version, Rule: rule, Message: message})
+		}
+	}
+
+	// Online schema changes don't lock the table
+	runsOnMySQL := (dialect == "mysql" || dialect == "") && !hasOnlineSchemaChangeMarker([]byte(contents))
+	for _, stmt := range splitStatements(contents) {
+		switch {
+		// Down migrations are expected to drop what their up migration created
+		case file.direction == "up" && destructiveStatement.MatchString(stmt):
+			add(LintDestructive, fmt.Sprintf("destructive statement: %s", truncateStatement(stmt)))
+
+		case dialect == "postgres" && createIndex.MatchString(stmt) && !concurrentIndex.MatchString(stmt):
+			add(LintPostgresIndex, fmt.Sprintf("index created without CONCURRENTLY blocks writes: %s", truncateStatement(stmt)))
+
+		case runsOnMySQL && alterTable.MatchString(stmt) && !onlineAlter.MatchString(stmt):
+			add(LintMySQLLockingAlter, fmt.Sprintf("ALTER TABLE may lock the table, specify ALGORITHM=INSTANT, ALGORITHM=INPLACE or LOCK=NONE: %s", truncateStatement(stmt)))
+		}
+	}
+	return issues
+}
+
+// lintVersions checks the versions and dialects across all migration files.
+func lintVersions(files []migrationFile, extraVersions []uint) []MigrationIssue {
+	var issues []MigrationIssue
+
+	type key struct {
+		direction, dialect string
+	}
+	byVersion := make(map[uint]map[key][]string)
+	titles := make(map[uint]map[string]bool)
+	dialectsInUse := make(map[string]bool)
+
+	for _, f := range files {
+		if byVersion[f.version] == nil {
+			byVersion[f.version] = make(map[key][]string)
+			titles[f.version] = make(map[string]bool)
+		}
+		k := key{f.direction, f.dialect}
+		byVersion[f.version][k] = append(byVersion[f.version][k], f.name)
+		titles[f.version][f.title] = true
+		if f.dialect != "" {
+			dialectsInUse[f.dialect] = true
+		}
+	}
+
+	versions := make([]uint, 0, len(byVersion)+len(extraVersions))
+	for v := range byVersion {
+		versions = append(versions, v)
+	}
+	versions = append(versions, extraVersions...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for i, v := range versions {
+		if i > 0 && versions[i-1] == v {
+			issues = append(issues, MigrationIssue{Version: v, Rule: LintDuplicateVersion, Message: "version is used by a Go migration and migration files"})
+			continue
+		}
+		if i > 0 && v < timestampVersion && v != versions[i-1]+1 {
+			issues = append(issues, MigrationIssue{Version: v, Rule: LintVersionGap, Message: fmt.Sprintf("versions %d to %d are missing", versions[i-1]+1, v-1)})
+		}
+
+		found := byVersion[v]
+		if found == nil {
+			continue // Go migration
+		}
+		if len(titles[v]) > 1 {
+			issues = append(issues, MigrationIssue{Version: v, Rule: LintDuplicateVersion, Message: fmt.Sprintf("version has multiple titles: %s", strings.Join(sortedKeys(titles[v]), ", "))})
+		}
+		for _, names := range found {
+			if len(names) > 1 {
+				sort.Strings(names)
+				issues = append(issues, MigrationIssue{Version: v, Rule: LintDuplicateVersion, Message: fmt.Sprintf("version has multiple files: %s", strings.Join(names, ", "))})
+			}
+		}
+
+		// Versions with a database specific up migration need one for every database in use
+		hasDialect := false
+		for k := range found {
+			if k.direction == "up" && k.dialect != "" {
+				hasDialect = true
+			}
+		}
+		if !hasDialect {
+			continue
+		}
+		_, generic := found[key{"up", ""}]
+		for _, dialect := range lintDialects {
+			if !dialectsInUse[dialect] {
+				continue
+			}
+			if _, exists := found[key{"up", dialect}]; exists || (generic && usesGeneric(dialect)) {
+				continue
+			}
+			issues = append(issues, MigrationIssue{Version: v, Rule: LintMissingDialect, Message: fmt.Sprintf("no %s migration", dialect)})
+		}
+	}
+	return issues
+}
+
+// lintMigrations analyzes the migrations planned to run and logs the issues found. Statements are
+// checked in the planned up or down files and version issues are only reported for planned up
+// migrations, so migrations which were already applied don't block later deploys. With LintFail
+// the issues are returned as a base.ErrorList of MigrationIssue.
+func lintMigrations(logger log.Logger, config DatabaseConfig, o *migrateOptions, planned []plannedMigration) error {
+	fsys := o.migrationsFS
+	if fsys == nil {
+		fsys = o.embeddedFS
+	}
+	if fsys == nil {
+		fsys = pkgerfs.FS
+	}
+	if len(planned) == 0 {
+		return nil
+	}
+
+	type key struct {
+		version   uint
+		direction string
+	}
+	pending := make(map[key]bool)
+	pendingUp := make(map[uint]bool)
+	for _, mig := range planned {
+		pending[key{mig.Version, mig.direction}] = true
+		if mig.direction == "up" {
+			pendingUp[mig.Version] = true
+		}
+	}
+
+	// Only the files for the configured database are checked. Embedded migrations run their generic
+	// files on every database, so those are checked as migrations for the configured database.
+	dialect := configDialect(config)
+	runs := func(file migrationFile) bool {
+		if !pending[key{file.version, file.direction}] {
+			return false
+		}
+		if file.dialect == "" {
+			return usesGeneric(dialect) || o.migrationsFS == nil
+		}
+		return file.dialect == dialect
+	}
+
+	var goVersions []uint
+	for v := range o.goMigrations {
+		goVersions = append(goVersions, v)
+	}
+
+	found, err := analyzeMigrations(fsys, "migrations", dialect, goVersions, runs)
+	if err != nil {
+		return err
+	}
+
+	var issues []MigrationIssue
+	for _, issue := range found {
+		// Statement issues come from planned files, version issues are kept for new versions
+		if issue.File != "" || pendingUp[issue.Version] {
+			issues = append(issues, issue)
+		}
+	}
+
+	var errs base.ErrorList
+	for _, issue := range issues {
+		logger.Warn().With(log.Fields{
+			"file":    log.String(issue.File),
+			"version": log.Int64(int64(issue.Version)),
+			"rule":    log.String(issue.Rule),
+		}).Log(issue.Message)
+		errs.Add(issue)
+	}
+
+	if *o.lint == LintFail && !errs.Empty() {
+		return logger.Error().LogErrorf("migration lint found %d issues: %w", len(issues), errs).Err()
+	}
+	return nil
+}
+
+// configDialect returns the name used in migration files for the database in config.
+func configDialect(config DatabaseConfig) string {
+	switch {
+	case config.MySQL != nil:
+		return "mysql"
+	case config.Postgres != nil:
+		return "postgres"
+	case config.Spanner != nil:
+		return "spanner"
+	case config.SQLite != nil:
+		return "sqlite"
+	}
+	return ""
+}
+
+func splitStatements(contents string) []string {
+	contents = sqlBlockComment.ReplaceAllString(contents, " ")
+	contents = sqlLineComment.ReplaceAllString(contents, " ")
+
+	var out []string
+	for _, stmt := range strings.Split(contents, ";") {
+		stmt = strings.TrimSpace(sqlWhitespace.ReplaceAllString(stmt, " "))
+		if stmt != "" {
+			out = append(out, strings.ToUpper(stmt))
+		}
+	}
+	return out
+}
+
+func truncateStatement(stmt string) string {
+	if len(stmt) > 80 {
+		return stmt[:77] + "..."
+	}
+	return stmt
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
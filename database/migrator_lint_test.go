@@ -0,0 +1,141 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+func TestAnalyzeMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_create_users.up.sql":          {Data: []byte("CREATE TABLE users (id VARCHAR(40), name VARCHAR(40));")},
+		"migrations/002_drop_name.up.sql":             {Data: []byte("-- cleanup\nALTER TABLE users\n  DROP COLUMN name;")},
+		"migrations/002_drop_name.down.sql":           {Data: []byte("ALTER TABLE users ADD COLUMN name VARCHAR(40);")},
+		"migrations/003_add_email.up.mysql.sql":       {Data: []byte("ALTER TABLE users ADD COLUMN email VARCHAR(100);")},
+		"migrations/003_add_email.up.postgres.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN email VARCHAR(100);")},
+		"migrations/004_index_email.up.postgres.sql":  {Data: []byte("CREATE UNIQUE INDEX users_email ON users (email);")},
+		"migrations/006_online.up.mysql.sql":          {Data: []byte("ALTER TABLE users ADD COLUMN age INT, ALGORITHM=INSTANT;")},
+		"migrations/006_online.up.postgres.sql":       {Data: []byte("CREATE INDEX CONCURRENTLY users_age ON users (age);")},
+		"migrations/007_truncate.up.sql":              {Data: []byte("/* intended */ TRUNCATE users; -- lint:ignore destructive")},
+		"migrations/008_one.up.sql":                   {Data: []byte("SELECT 1;")},
+		"migrations/008_two.up.sql":                   {Data: []byte("SELECT 2;")},
+		"migrations/README.md":                        {Data: []byte("not a migration")},
+		"migrations/20240102150405_timestamp.up.sql":  {Data: []byte("SELECT 1;")},
+		"migrations/20240301000000_timestamp2.up.sql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	issues, err := database.AnalyzeMigrations(fsys, "migrations")
+	require.NoError(t, err)
+
+	type found struct {
+		Version uint
+		Rule    string
+		File    string
+	}
+	var got []found
+	for _, issue := range issues {
+		got = append(got, found{issue.Version, issue.Rule, issue.File})
+	}
+	require.ElementsMatch(t, []found{
+		{2, database.LintDestructive, "002_drop_name.up.sql"},
+		{3, database.LintMySQLLockingAlter, "003_add_email.up.mysql.sql"},
+		{4, database.LintPostgresIndex, "004_index_email.up.postgres.sql"},
+		{4, database.LintMissingDialect, ""},
+		{6, database.LintVersionGap, ""},
+		{8, database.LintDuplicateVersion, ""},
+		{8, database.LintDuplicateVersion, ""},
+		{20240301000000, database.LintDestructive, "20240301000000_timestamp2.up.sql"},
+	}, got)
+
+	for _, issue := range issues {
+		switch {
+		case issue.Rule == database.LintMissingDialect:
+			require.EqualError(t, issue, "migration 4: missing-dialect: no mysql migration")
+		case issue.Rule == database.LintVersionGap:
+			require.Equal(t, "versions 5 to 5 are missing", issue.Message)
+		case issue.Version == 2:
+			require.EqualError(t, issue, "002_drop_name.up.sql: destructive: destructive statement: ALTER TABLE USERS DROP COLUMN NAME")
+		}
+	}
+
+	_, err = database.AnalyzeMigrations(fsys, "missing")
+	require.Error(t, err)
+}
+
+func TestAnalyzeMigrations_Repository(t *testing.T) {
+	issues, err := database.AnalyzeMigrations(os.DirFS(".."), "migrations")
+	require.NoError(t, err)
+	require.Empty(t, issues)
+}
+
+func TestMigrationLint(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewTestLogger()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	migrations := database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_items.up.sql": {Data: []byte("CREATE TABLE items (id TEXT, name TEXT);")},
+		"migrations/002_drop_name.up.sql":    {Data: []byte("ALTER TABLE items DROP COLUMN name;")},
+	})
+
+	// Failing stops before any migration runs
+	err = database.RunMigrationsContext(ctx, logger, config, migrations, database.WithMigrationLint(database.LintFail))
+	require.ErrorContains(t, err, "migration lint found 1 issues")
+	require.ErrorContains(t, err, "002_drop_name.up.sql: destructive")
+
+	state, err := database.MigrationStatus(ctx, logger, config, migrations)
+	require.NoError(t, err)
+	require.Equal(t, uint(0), state.Version)
+
+	// Warnings are logged and the migrations run
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, migrations, database.WithMigrationLint(database.LintWarn)))
+
+	state, err = database.MigrationStatus(ctx, logger, config, migrations)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), state.Version)
+
+	// Applied migrations don't block later ones
+	migrations = database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_items.up.sql":  {Data: []byte("CREATE TABLE items (id TEXT, name TEXT);")},
+		"migrations/002_drop_name.up.sql":     {Data: []byte("ALTER TABLE items DROP COLUMN name;")},
+		"migrations/002_drop_name.down.sql":   {Data: []byte("DROP TABLE items;")},
+		"migrations/003_create_tags.up.sql":   {Data: []byte("CREATE TABLE tags (id TEXT);")},
+		"migrations/003_create_tags.down.sql": {Data: []byte("DROP TABLE tags;")},
+	})
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, config, migrations, database.WithMigrationLint(database.LintFail)))
+
+	// Rolling back isn't blocked by down files dropping what their up migration created
+	require.NoError(t, database.MigrateDown(ctx, logger, config, 1, migrations, database.WithMigrationLint(database.LintFail)))
+
+	state, err = database.MigrationStatus(ctx, logger, config, migrations)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), state.Version)
+
+	// Embedded migrations are linted too
+	other, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, other, database.WithEmbeddedMigrations(base.SQLiteMigrations), database.WithMigrationLint(database.LintFail)))
+
+	// Generic embedded files are checked as migrations for the configured database
+	embedded, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, embedded, database.WithEmbeddedMigrations(fstest.MapFS{
+		"migrations/001_create_items.up.sql": {Data: []byte("CREATE TABLE items (id TEXT);")},
+		"migrations/002_add_name.up.sql":     {Data: []byte("ALTER TABLE items ADD COLUMN name TEXT;")},
+	}), database.WithMigrationLint(database.LintFail)))
+
+	// Without a source the migrations packed by pkger are linted
+	fresh, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, fresh, database.WithMigrationLint(database.LintFail)))
+}
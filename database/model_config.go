@@ -5,6 +5,7 @@ package database
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/moov-io/base/mask"
@@ -14,13 +15,14 @@ type DatabaseConfig struct {
 	MySQL        *MySQLConfig
 	Spanner      *SpannerConfig
 	Postgres     *PostgresConfig
+	SQLite       *SQLiteConfig
 	DatabaseName string
 	Retries      *RetryConfig
 }
 
 type SpannerConfig struct {
-	Project  string
-	Instance string
+	Project  string `validate:"required"`
+	Instance string `validate:"required"`
 
 	DisableCleanStatements bool
 }
@@ -32,10 +34,11 @@ type PostgresConfig struct {
 	Connections ConnectionsConfig
 	TLS         *PostgresTLSConfig
 	Alloy       *PostgresAlloyConfig
+	Replicas    *ReplicaConfig
 }
 
 type PostgresTLSConfig struct {
-	Mode string
+	Mode string `validate:"oneof=disable allow prefer require verify-ca verify-full"`
 
 	CACertFile     string
 	ClientKeyFile  string
@@ -43,13 +46,13 @@ type PostgresTLSConfig struct {
 }
 
 type PostgresAlloyConfig struct {
-	InstanceURI string
+	InstanceURI string `validate:"required"`
 	UseIAM      bool
 	UsePSC      bool
 }
 
 type MySQLConfig struct {
-	Address        string
+	Address        string `validate:"required"`
 	User           string
 	Password       string `json:"-"`
 	Connections    ConnectionsConfig
@@ -57,6 +60,7 @@ type MySQLConfig struct {
 	TLSCAFile      string
 	VerifyCAFile   bool
 	TLSClientCerts []TLSClientCertConfig
+	Replicas       *ReplicaConfig
 
 	// InsecureSkipVerify is a dangerous option which should be used with extreme caution.
 	// This setting disables multiple security checks performed with TLS connections.
@@ -78,6 +82,7 @@ func (m *MySQLConfig) MarshalJSON() ([]byte, error) {
 		TLSCAFile          string
 		InsecureSkipVerify bool
 		VerifyCAFile       bool
+		Replicas           *ReplicaConfig
 	}
 
 	return json.Marshal(Aux{
@@ -89,18 +94,58 @@ func (m *MySQLConfig) MarshalJSON() ([]byte, error) {
 		TLSCAFile:          m.TLSCAFile,
 		InsecureSkipVerify: m.InsecureSkipVerify,
 		VerifyCAFile:       m.VerifyCAFile,
+		Replicas:           m.Replicas,
 	})
 }
 
+// ReplicaConfig lists read replicas of a MySQL or Postgres database. Replicas are connected to with the
+// same user, password and TLS settings as the primary. See NewRouter.
+type ReplicaConfig struct {
+	Addresses []string
+
+	// MaxLag is how far behind the primary a replica can be and still be used, zero disables lag checks.
+	MaxLag time.Duration `validate:"min=0s"`
+
+	// HealthCheckInterval is how often replicas are checked, defaulting to 10s.
+	HealthCheckInterval time.Duration `validate:"min=0s"`
+}
+
+// SQLiteConfig opens a database file, or an in-memory database when Path is SQLiteMemory.
+// In-memory databases are shared by connections using the same DatabaseName and live until
+// CloseSQLiteMemoryDatabase is called or the process exits.
+type SQLiteConfig struct {
+	Path        string        `validate:"required"`
+	JournalMode string        `validate:"oneof=delete truncate persist memory wal off"`
+	BusyTimeout time.Duration `validate:"min=0s"`
+	Connections ConnectionsConfig
+}
+
 type ConnectionsConfig struct {
-	MaxOpen     int
-	MaxIdle     int
-	MaxLifetime time.Duration
-	MaxIdleTime time.Duration
+	MaxOpen     int           `validate:"min=0"`
+	MaxIdle     int           `validate:"min=0"`
+	MaxLifetime time.Duration `validate:"min=0s"`
+	MaxIdleTime time.Duration `validate:"min=0s"`
 }
 
 type RetryConfig struct {
-	MaxAttempts int
-	MinDuration time.Duration
-	MaxDuration time.Duration
+	MaxAttempts int           `validate:"min=0"`
+	MinDuration time.Duration `validate:"min=0s"`
+	MaxDuration time.Duration `validate:"min=0s"`
+}
+
+// Validate requires a database name once a database has been configured.
+func (cfg *DatabaseConfig) Validate() error {
+	configured := cfg.MySQL != nil || cfg.Spanner != nil || cfg.Postgres != nil || cfg.SQLite != nil
+	if configured && cfg.DatabaseName == "" {
+		return errors.New("database name is required")
+	}
+	return nil
+}
+
+// Validate requires an Address unless connecting through the AlloyDB connector.
+func (cfg *PostgresConfig) Validate() error {
+	if cfg.Alloy == nil && cfg.Address == "" {
+		return errors.New("postgres address is required")
+	}
+	return nil
 }
@@ -48,6 +48,7 @@ var (
 	mySQLErrDuplicateKey  uint16 = 1062
 	mysqlErrDataTooLong   uint16 = 1406
 	mysqlErrDeadlockFound uint16 = 1213
+	mysqlErrParse         uint16 = 1064
 
 	maxActiveMySQLConnections = func() int {
 		if v := os.Getenv("MYSQL_MAX_CONNECTIONS"); v != "" {
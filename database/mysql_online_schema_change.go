@@ -0,0 +1,649 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/telemetry"
+)
+
+// OnlineSchemaChangeMarker is a line in a MySQL migration which runs each of its ALTER TABLE
+// statements as an online schema change instead of altering the table in place.
+//
+// The table is copied into a shadow table with the new schema in chunks of rows by primary key while
+// triggers copy concurrent writes. Once the copy is complete the tables are swapped with an atomic
+// RENAME TABLE. Progress is saved in the online_schema_changes table, so after a failure the version
+// can be reset with ForceVersion and the next run continues copying where it stopped.
+//
+// Tables need a single column primary key and can't have foreign keys or be referenced by one, as
+// those would follow the original table through the swap. Statements may add, modify or drop
+// columns and indexes but not rename columns or the table.
+const OnlineSchemaChangeMarker = "-- +online-schema-change"
+
+// OnlineSchemaChangeConfig tunes how online schema changes copy rows.
+type OnlineSchemaChangeConfig struct {
+	// ChunkSize is how many rows are copied at a time. Defaults to 1,000.
+	ChunkSize int
+
+	// ChunkPause is how long to wait between chunks.
+	ChunkPause time.Duration
+
+	// MaxLag pauses copying while any replica from MySQLConfig.Replicas is further behind the primary.
+	// Defaults to ReplicaConfig.MaxLag.
+	MaxLag time.Duration
+
+	// ThrottleInterval is how long to wait before checking replica lag again. Defaults to one second.
+	ThrottleInterval time.Duration
+
+	// KeepOldTable leaves the original table renamed to _{table}_old after the swap.
+	KeepOldTable bool
+}
+
+// WithOnlineSchemaChanges configures migrations marked with OnlineSchemaChangeMarker.
+func WithOnlineSchemaChanges(cfg OnlineSchemaChangeConfig) MigrateOption {
+	return func(o *migrateOptions) error {
+		if cfg.ChunkSize < 0 {
+			return fmt.Errorf("invalid online schema change chunk size: %d", cfg.ChunkSize)
+		}
+		o.onlineSchemaChanges = &cfg
+		return nil
+	}
+}
+
+const onlineSchemaChangesTable = `CREATE TABLE IF NOT EXISTS online_schema_changes (
+	table_name VARCHAR(64) NOT NULL PRIMARY KEY,
+	alter_statement TEXT NOT NULL,
+	last_key VARCHAR(255),
+	rows_copied BIGINT NOT NULL DEFAULT 0,
+	started_at DATETIME(6) NOT NULL,
+	updated_at DATETIME(6) NOT NULL
+)`
+
+var (
+	onlineAlterStatement = regexp.MustCompile("(?is)^ALTER\\s+TABLE\\s+`?([A-Za-z0-9_$]+)`?\\s+(.+)$")
+	onlineRenames        = regexp.MustCompile(`(?i)\b(RENAME|CHANGE)\b`)
+)
+
+// onlineSchemaChangeProgressInterval is how often copy progress is logged.
+const onlineSchemaChangeProgressInterval = 10 * time.Second
+
+type tableAlter struct {
+	table string
+	alter string
+}
+
+// hasOnlineSchemaChangeMarker reports if a line of the migration is OnlineSchemaChangeMarker.
+func hasOnlineSchemaChangeMarker(migration []byte) bool {
+	for _, line := range strings.Split(string(migration), "\n") {
+		if strings.TrimSpace(line) == OnlineSchemaChangeMarker {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOnlineSchemaChanges returns each ALTER TABLE statement of a marked migration.
+func parseOnlineSchemaChanges(migration []byte) ([]tableAlter, error) {
+	contents := sqlBlockComment.ReplaceAllString(string(migration), " ")
+	contents = sqlLineComment.ReplaceAllString(contents, " ")
+
+	var out []tableAlter
+	for _, stmt := range strings.Split(contents, ";") {
+		stmt = strings.TrimSpace(sqlWhitespace.ReplaceAllString(stmt, " "))
+		if stmt == "" {
+			continue
+		}
+		matches := onlineAlterStatement.FindStringSubmatch(stmt)
+		if matches == nil {
+			return nil, fmt.Errorf("online schema change migrations can only contain ALTER TABLE statements: %s", truncateStatement(stmt))
+		}
+		if onlineRenames.MatchString(matches[2]) {
+			return nil, fmt.Errorf("online schema changes can't rename columns or tables: %s", truncateStatement(stmt))
+		}
+		if len(matches[1]) > 55 {
+			return nil, fmt.Errorf("table name %s is too long for an online schema change", matches[1])
+		}
+		out = append(out, tableAlter{table: matches[1], alter: matches[2]})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("online schema change migration has no ALTER TABLE statements")
+	}
+	return out, nil
+}
+
+// onlineSchemaChangeDriver runs migrations marked with OnlineSchemaChangeMarker as online schema
+// changes and passes every other migration to the underlying driver.
+type onlineSchemaChangeDriver struct {
+	database.Driver
+
+	ctx    context.Context
+	logger log.Logger
+	config DatabaseConfig
+	cfg    OnlineSchemaChangeConfig
+}
+
+// withOnlineSchemaChanges wraps the MySQL driver in o to run marked migrations as online schema changes.
+func withOnlineSchemaChanges(ctx context.Context, logger log.Logger, config DatabaseConfig, o *migrateOptions) database.Driver {
+	cfg := OnlineSchemaChangeConfig{}
+	if o.onlineSchemaChanges != nil {
+		cfg = *o.onlineSchemaChanges
+	}
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = 1000
+	}
+	if cfg.ThrottleInterval <= 0 {
+		cfg.ThrottleInterval = time.Second
+	}
+	if cfg.MaxLag == 0 && config.MySQL.Replicas != nil {
+		cfg.MaxLag = config.MySQL.Replicas.MaxLag
+	}
+
+	o.driver = &onlineSchemaChangeDriver{
+		Driver: o.driver,
+		ctx:    ctx,
+		logger: logger,
+		config: config,
+		cfg:    cfg,
+	}
+	return o.driver
+}
+
+func (d *onlineSchemaChangeDriver) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if !hasOnlineSchemaChangeMarker(body) {
+		return d.Driver.Run(bytes.NewReader(body))
+	}
+
+	alters, err := parseOnlineSchemaChanges(body)
+	if err != nil {
+		return err
+	}
+
+	// The migration driver holds a connection for the migration lock so copying uses its own
+	db, err := New(d.ctx, d.logger, d.config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	replicas, err := d.openReplicas()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, r := range replicas {
+			r.DB.Close()
+		}
+	}()
+
+	if _, err := db.ExecContext(d.ctx, onlineSchemaChangesTable); err != nil {
+		return fmt.Errorf("creating online_schema_changes: %w", err)
+	}
+
+	for _, alter := range alters {
+		osc := &onlineSchemaChange{
+			tableAlter: alter,
+			logger:     d.logger.Set("table", log.String(alter.table)),
+			db:         db,
+			replicas:   replicas,
+			cfg:        d.cfg,
+		}
+		if err := osc.run(d.ctx); err != nil {
+			return fmt.Errorf("online schema change of %s: %w", alter.table, err)
+		}
+	}
+	return nil
+}
+
+// openReplicas connects to the replicas whose lag throttles copying.
+func (d *onlineSchemaChangeDriver) openReplicas() ([]Replica, error) {
+	if d.cfg.MaxLag <= 0 || d.config.MySQL.Replicas == nil {
+		return nil, nil
+	}
+
+	var replicas []Replica
+	for _, address := range d.config.MySQL.Replicas.Addresses {
+		db, err := New(d.ctx, d.logger.Set("replica", log.String(address)), replicaConfig(d.config, address))
+		if err != nil {
+			for _, r := range replicas {
+				r.DB.Close()
+			}
+			return nil, fmt.Errorf("connecting to replica %s: %w", address, err)
+		}
+		replicas = append(replicas, Replica{Name: address, DB: db})
+	}
+	return replicas, nil
+}
+
+type onlineSchemaChange struct {
+	tableAlter
+
+	logger   log.Logger
+	db       *sql.DB
+	replicas []Replica
+	cfg      OnlineSchemaChangeConfig
+
+	primaryKey string
+	columns    []string
+
+	lastKey    sql.NullString
+	rowsCopied int64
+}
+
+func (c *onlineSchemaChange) shadowTable() string { return "_" + c.table + "_new" }
+func (c *onlineSchemaChange) oldTable() string    { return "_" + c.table + "_old" }
+
+func (c *onlineSchemaChange) triggers() []string {
+	return []string{"_" + c.table + "_osc_ins", "_" + c.table + "_osc_upd", "_" + c.table + "_osc_del"}
+}
+
+func (c *onlineSchemaChange) run(ctx context.Context) error {
+	ctx, span := telemetry.StartSpan(ctx, "online-schema-change", trace.WithAttributes(
+		attribute.String("db.table", c.table),
+		attribute.String("db.alter", c.alter),
+	))
+	defer span.End()
+
+	var err error
+	c.primaryKey, err = c.readPrimaryKey(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.checkForeignKeys(ctx); err != nil {
+		return err
+	}
+
+	resumed, err := c.resume(ctx)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		c.logger.Info().Logf("Resuming online schema change after %d rows", c.rowsCopied)
+		span.AddEvent("resumed", trace.WithAttributes(attribute.Int64("db.rows_copied", c.rowsCopied)))
+	} else {
+		c.logger.Info().Logf("Starting online schema change: %s", c.alter)
+		if err := c.createShadow(ctx); err != nil {
+			return err
+		}
+		span.AddEvent("shadow-created")
+	}
+
+	if err := c.copyRows(ctx, span); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int64("db.rows_copied", c.rowsCopied))
+	span.AddEvent("copy-complete")
+
+	if err := c.swap(ctx); err != nil {
+		return err
+	}
+	span.AddEvent("swapped")
+
+	c.logger.Info().Logf("Online schema change complete after copying %d rows", c.rowsCopied)
+	return nil
+}
+
+func (c *onlineSchemaChange) readPrimaryKey(ctx context.Context) (string, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION`, c.table)
+	if err != nil {
+		return "", fmt.Errorf("reading primary key: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return "", err
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(columns) != 1 {
+		return "", fmt.Errorf("table needs a single column primary key, found %d columns", len(columns))
+	}
+	return columns[0], nil
+}
+
+// checkForeignKeys refuses tables with foreign keys or referenced by other tables' foreign keys.
+// Child foreign keys would point at the _{table}_old table after the swap.
+func (c *onlineSchemaChange) checkForeignKeys(ctx context.Context) error {
+	rows, err := c.db.QueryContext(ctx, `SELECT CONSTRAINT_NAME, TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.REFERENTIAL_CONSTRAINTS
+WHERE CONSTRAINT_SCHEMA = DATABASE() AND (TABLE_NAME = ? OR REFERENCED_TABLE_NAME = ?) ORDER BY CONSTRAINT_NAME`, c.table, c.table)
+	if err != nil {
+		return fmt.Errorf("reading foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var found []string
+	for rows.Next() {
+		var name, table, referenced string
+		if err := rows.Scan(&name, &table, &referenced); err != nil {
+			return err
+		}
+		found = append(found, fmt.Sprintf("%s (%s references %s)", name, table, referenced))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("online schema changes don't support tables with foreign keys, found %s", strings.Join(found, ", "))
+	}
+	return nil
+}
+
+// resume loads the progress of an earlier attempt when its shadow table and triggers still exist.
+func (c *onlineSchemaChange) resume(ctx context.Context) (bool, error) {
+	var alter string
+	err := c.db.QueryRowContext(ctx, `SELECT alter_statement, last_key, rows_copied FROM online_schema_changes WHERE table_name = ?`, c.table).
+		Scan(&alter, &c.lastKey, &c.rowsCopied)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading progress: %w", err)
+	}
+	if alter != c.alter {
+		return false, fmt.Errorf("a different online schema change is in progress: %s", alter)
+	}
+
+	var found int
+	err = c.db.QueryRowContext(ctx, `SELECT
+(SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?) +
+(SELECT COUNT(*) FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = DATABASE() AND TRIGGER_NAME IN (?, ?, ?))`,
+		c.shadowTable(), c.triggers()[0], c.triggers()[1], c.triggers()[2]).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("checking shadow table: %w", err)
+	}
+	if found != 4 {
+		// Start over as writes may have been missed
+		c.lastKey, c.rowsCopied = sql.NullString{}, 0
+		return false, nil
+	}
+
+	c.columns, err = c.sharedColumns(ctx)
+	return true, err
+}
+
+func (c *onlineSchemaChange) createShadow(ctx context.Context) error {
+	shadow := quoteIdentifier(c.shadowTable())
+
+	stmts := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", shadow),
+	}
+	for _, trigger := range c.triggers() {
+		stmts = append(stmts, fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdentifier(trigger)))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("CREATE TABLE %s LIKE %s", shadow, quoteIdentifier(c.table)),
+		fmt.Sprintf("ALTER TABLE %s %s", shadow, c.alter),
+	)
+	for _, stmt := range stmts {
+		if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating shadow table: %w", err)
+		}
+	}
+
+	var err error
+	c.columns, err = c.sharedColumns(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range c.triggerStatements() {
+		if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating trigger: %w", err)
+		}
+	}
+
+	_, err = c.db.ExecContext(ctx, `REPLACE INTO online_schema_changes (table_name, alter_statement, last_key, rows_copied, started_at, updated_at)
+VALUES (?, ?, NULL, 0, NOW(6), NOW(6))`, c.table, c.alter)
+	if err != nil {
+		return fmt.Errorf("saving progress: %w", err)
+	}
+	c.lastKey, c.rowsCopied = sql.NullString{}, 0
+	return nil
+}
+
+// sharedColumns returns the columns of the table, in order, which are also in the shadow table.
+func (c *onlineSchemaChange) sharedColumns(ctx context.Context) ([]string, error) {
+	original, err := c.readColumns(ctx, c.table)
+	if err != nil {
+		return nil, err
+	}
+	shadow, err := c.readColumns(ctx, c.shadowTable())
+	if err != nil {
+		return nil, err
+	}
+
+	inShadow := make(map[string]bool)
+	for _, column := range shadow {
+		inShadow[strings.ToLower(column)] = true
+	}
+	var columns []string
+	for _, column := range original {
+		if inShadow[strings.ToLower(column)] {
+			columns = append(columns, column)
+		}
+	}
+	if !inShadow[strings.ToLower(c.primaryKey)] {
+		return nil, fmt.Errorf("primary key %s can't be dropped", c.primaryKey)
+	}
+	return columns, nil
+}
+
+func (c *onlineSchemaChange) readColumns(ctx context.Context, table string) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT COLUMN_NAME FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND EXTRA NOT LIKE '%GENERATED%' ORDER BY ORDINAL_POSITION`, table)
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// triggerStatements returns the triggers which copy writes on the table to the shadow table.
+func (c *onlineSchemaChange) triggerStatements() []string {
+	table, shadow, pk := quoteIdentifier(c.table), quoteIdentifier(c.shadowTable()), quoteIdentifier(c.primaryKey)
+
+	columns := make([]string, len(c.columns))
+	values := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		columns[i] = quoteIdentifier(column)
+		values[i] = "NEW." + quoteIdentifier(column)
+	}
+	replace := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", shadow, strings.Join(columns, ", "), strings.Join(values, ", "))
+	remove := fmt.Sprintf("DELETE IGNORE FROM %s WHERE %s <=> OLD.%s", shadow, pk, pk)
+
+	names := c.triggers()
+	return []string{
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s FOR EACH ROW %s", quoteIdentifier(names[0]), table, replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s FOR EACH ROW BEGIN %s; %s; END", quoteIdentifier(names[1]), table, remove, replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s FOR EACH ROW %s", quoteIdentifier(names[2]), table, remove),
+	}
+}
+
+// copyRows copies chunks of rows into the shadow table in primary key order.
+func (c *onlineSchemaChange) copyRows(ctx context.Context, span trace.Span) error {
+	table, pk := quoteIdentifier(c.table), quoteIdentifier(c.primaryKey)
+
+	columns := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		columns[i] = quoteIdentifier(column)
+	}
+	columnList := strings.Join(columns, ", ")
+
+	// The estimate is only used in progress logs
+	var estimate int64
+	_ = c.db.QueryRowContext(ctx, `SELECT COALESCE(TABLE_ROWS, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, c.table).Scan(&estimate)
+
+	lastReport := time.Now()
+	for {
+		if err := c.throttle(ctx, span); err != nil {
+			return err
+		}
+
+		lower, args := "", []interface{}{}
+		if c.lastKey.Valid {
+			lower, args = fmt.Sprintf("WHERE %s > ?", pk), []interface{}{c.lastKey.String}
+		}
+
+		// Find the last key of this chunk, which is missing on the final chunk
+		var upper sql.NullString
+		err := c.db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY %s LIMIT 1 OFFSET %d", pk, table, lower, pk, c.cfg.ChunkSize-1), args...).Scan(&upper)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("finding next chunk: %w", err)
+		}
+
+		where, copyArgs := lower, args
+		if upper.Valid {
+			if where == "" {
+				where = fmt.Sprintf("WHERE %s <= ?", pk)
+			} else {
+				where += fmt.Sprintf(" AND %s <= ?", pk)
+			}
+			copyArgs = append(copyArgs, upper.String)
+		}
+
+		res, err := c.db.ExecContext(ctx, fmt.Sprintf("INSERT LOW_PRIORITY IGNORE INTO %s (%s) SELECT %s FROM %s FORCE INDEX (PRIMARY) %s LOCK IN SHARE MODE",
+			quoteIdentifier(c.shadowTable()), columnList, columnList, table, where), copyArgs...)
+		if err != nil {
+			return fmt.Errorf("copying rows: %w", err)
+		}
+		copied, _ := res.RowsAffected()
+		c.rowsCopied += copied
+
+		if !upper.Valid {
+			return nil
+		}
+		c.lastKey = upper
+
+		_, err = c.db.ExecContext(ctx, `UPDATE online_schema_changes SET last_key = ?, rows_copied = ?, updated_at = NOW(6) WHERE table_name = ?`,
+			c.lastKey.String, c.rowsCopied, c.table)
+		if err != nil {
+			return fmt.Errorf("saving progress: %w", err)
+		}
+
+		if time.Since(lastReport) >= onlineSchemaChangeProgressInterval {
+			lastReport = time.Now()
+			c.logger.Info().With(log.Fields{
+				"rows_copied":   log.Int64(c.rowsCopied),
+				"rows_estimate": log.Int64(estimate),
+			}).Logf("Online schema change copied %d of about %d rows", c.rowsCopied, estimate)
+			span.AddEvent("progress", trace.WithAttributes(attribute.Int64("db.rows_copied", c.rowsCopied)))
+		}
+
+		if c.cfg.ChunkPause > 0 {
+			if err := sleepContext(ctx, c.cfg.ChunkPause); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// throttle waits until every replica is within MaxLag of the primary.
+func (c *onlineSchemaChange) throttle(ctx context.Context, span trace.Span) error {
+	if c.cfg.MaxLag <= 0 {
+		return nil
+	}
+	for {
+		lagging := ""
+		for _, r := range c.replicas {
+			lag, err := MySQLReplicaLag(ctx, r.DB)
+			if err != nil {
+				c.logger.Warn().Set("replica", log.String(r.Name)).LogErrorf("checking replica lag: %w", err)
+				lagging = r.Name
+				break
+			}
+			if lag > c.cfg.MaxLag {
+				lagging = r.Name
+				break
+			}
+		}
+		if lagging == "" {
+			return nil
+		}
+
+		c.logger.Info().Set("replica", log.String(lagging)).Logf("Online schema change paused while replica is behind by over %v", c.cfg.MaxLag)
+		span.AddEvent("throttled", trace.WithAttributes(attribute.String("db.replica", lagging)))
+
+		if err := sleepContext(ctx, c.cfg.ThrottleInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// swap renames the shadow table into place and removes the triggers and original table.
+func (c *onlineSchemaChange) swap(ctx context.Context) error {
+	table, shadow, old := quoteIdentifier(c.table), quoteIdentifier(c.shadowTable()), quoteIdentifier(c.oldTable())
+
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", old)); err != nil {
+		return fmt.Errorf("dropping %s: %w", c.oldTable(), err)
+	}
+	if _, err := c.db.ExecContext(ctx, fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", table, old, shadow, table)); err != nil {
+		return fmt.Errorf("swapping tables: %w", err)
+	}
+
+	// The triggers moved with the original table
+	for _, trigger := range c.triggers() {
+		if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DROP TRIGGER IF EXISTS %s", quoteIdentifier(trigger))); err != nil {
+			return fmt.Errorf("dropping trigger %s: %w", trigger, err)
+		}
+	}
+	if !c.cfg.KeepOldTable {
+		if _, err := c.db.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", old)); err != nil {
+			return fmt.Errorf("dropping %s: %w", c.oldTable(), err)
+		}
+	}
+
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM online_schema_changes WHERE table_name = ?`, c.table); err != nil {
+		return fmt.Errorf("clearing progress: %w", err)
+	}
+	return nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
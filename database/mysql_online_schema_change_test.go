@@ -0,0 +1,68 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnlineSchemaChangeMarker(t *testing.T) {
+	require.True(t, hasOnlineSchemaChangeMarker([]byte("-- +online-schema-change\nALTER TABLE users ADD COLUMN age INT;")))
+	require.True(t, hasOnlineSchemaChangeMarker([]byte("-- resize\n  -- +online-schema-change  \nALTER TABLE users ADD COLUMN age INT;")))
+	require.False(t, hasOnlineSchemaChangeMarker([]byte("ALTER TABLE users ADD COLUMN age INT; -- +online-schema-change")))
+	require.False(t, hasOnlineSchemaChangeMarker([]byte("ALTER TABLE users ADD COLUMN age INT;")))
+}
+
+func TestParseOnlineSchemaChanges(t *testing.T) {
+	alters, err := parseOnlineSchemaChanges([]byte(`-- +online-schema-change
+ALTER TABLE users
+  ADD COLUMN age INT NOT NULL DEFAULT 0,
+  ADD INDEX users_age (age);
+
+/* second table */
+ALTER TABLE ` + "`orders`" + ` MODIFY amount BIGINT;
+`))
+	require.NoError(t, err)
+	require.Equal(t, []tableAlter{
+		{table: "users", alter: "ADD COLUMN age INT NOT NULL DEFAULT 0, ADD INDEX users_age (age)"},
+		{table: "orders", alter: "MODIFY amount BIGINT"},
+	}, alters)
+
+	cases := map[string]string{
+		"-- +online-schema-change\nUPDATE users SET age = 1;":               "can only contain ALTER TABLE statements",
+		"-- +online-schema-change\nALTER TABLE users RENAME COLUMN a TO b;": "can't rename columns or tables",
+		"-- +online-schema-change\nALTER TABLE users CHANGE a b INT;":       "can't rename columns or tables",
+		"-- +online-schema-change\n":                                        "has no ALTER TABLE statements",
+		"-- +online-schema-change\nALTER TABLE users;":                      "can only contain ALTER TABLE statements",
+	}
+	for migration, expected := range cases {
+		_, err := parseOnlineSchemaChanges([]byte(migration))
+		require.ErrorContains(t, err, expected, migration)
+	}
+}
+
+func TestOnlineSchemaChange_Triggers(t *testing.T) {
+	c := &onlineSchemaChange{
+		tableAlter: tableAlter{table: "users", alter: "DROP COLUMN nickname"},
+		primaryKey: "id",
+		columns:    []string{"id", "name"},
+	}
+	require.Equal(t, "_users_new", c.shadowTable())
+	require.Equal(t, "_users_old", c.oldTable())
+
+	require.Equal(t, []string{
+		"CREATE TRIGGER `_users_osc_ins` AFTER INSERT ON `users` FOR EACH ROW " +
+			"REPLACE INTO `_users_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`)",
+		"CREATE TRIGGER `_users_osc_upd` AFTER UPDATE ON `users` FOR EACH ROW BEGIN " +
+			"DELETE IGNORE FROM `_users_new` WHERE `id` <=> OLD.`id`; " +
+			"REPLACE INTO `_users_new` (`id`, `name`) VALUES (NEW.`id`, NEW.`name`); END",
+		"CREATE TRIGGER `_users_osc_del` AFTER DELETE ON `users` FOR EACH ROW " +
+			"DELETE IGNORE FROM `_users_new` WHERE `id` <=> OLD.`id`",
+	}, c.triggerStatements())
+}
+
+func TestAnalyzeMigrations_OnlineSchemaChange(t *testing.T) {
+	issues := lintStatements(migrationFile{name: "002_add_age.up.mysql.sql", version: 2, direction: "up", dialect: "mysql"}, "",
+		"-- +online-schema-change\nALTER TABLE users ADD COLUMN age INT;")
+	require.Empty(t, issues)
+}
@@ -7,7 +7,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/moov-io/base"
@@ -119,3 +121,77 @@ func Test_MySQL_Embedded_Migration(t *testing.T) {
 	require.NoError(t, err)
 	defer db.Close()
 }
+
+func TestMySQL_OnlineSchemaChange(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short flag enabled")
+	}
+
+	ctx := context.Background()
+	mysqlConfig := database.DatabaseConfig{
+		DatabaseName: "osc" + base.ID(),
+		MySQL: &database.MySQLConfig{
+			User:     "root",
+			Password: "root",
+			Address:  "tcp(127.0.0.1:3306)",
+		},
+	}
+	require.NoError(t, testdb.NewMySQLDatabase(t, mysqlConfig))
+
+	migrations := database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_users.up.mysql.sql": {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(40), nickname VARCHAR(40));")},
+		"migrations/002_alter_users.up.mysql.sql": {Data: []byte(database.OnlineSchemaChangeMarker + `
+ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 18, DROP COLUMN nickname, ADD INDEX users_age (age);
+`)},
+	})
+	logger := log.NewTestLogger()
+
+	require.NoError(t, database.MigrateTo(ctx, logger, mysqlConfig, 1, migrations))
+
+	db, err := database.New(ctx, logger, mysqlConfig)
+	require.NoError(t, err)
+	defer db.Close()
+
+	for i := 1; i <= 25; i++ {
+		_, err := db.Exec(`INSERT INTO users (id, name, nickname) VALUES (?, ?, ?)`, i, fmt.Sprintf("user %d", i), "nick")
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, database.RunMigrationsContext(ctx, logger, mysqlConfig, migrations, database.WithOnlineSchemaChanges(database.OnlineSchemaChangeConfig{
+		ChunkSize: 10,
+	})))
+
+	var count, age int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*), MIN(age) FROM users`).Scan(&count, &age))
+	require.Equal(t, 25, count)
+	require.Equal(t, 18, age)
+
+	var name string
+	require.NoError(t, db.QueryRow(`SELECT name FROM users WHERE id = 7`).Scan(&name))
+	require.Equal(t, "user 7", name)
+
+	_, err = db.Exec(`SELECT nickname FROM users`)
+	require.ErrorContains(t, err, "Unknown column")
+
+	// The shadow table, triggers and progress are cleaned up
+	var leftover int
+	require.NoError(t, db.QueryRow(`SELECT
+(SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE '\_users\_%') +
+(SELECT COUNT(*) FROM information_schema.TRIGGERS WHERE TRIGGER_SCHEMA = DATABASE()) +
+(SELECT COUNT(*) FROM online_schema_changes)`).Scan(&leftover))
+	require.Equal(t, 0, leftover)
+
+	// Tables referenced by foreign keys are refused
+	migrations = database.WithMigrationsFS(fstest.MapFS{
+		"migrations/001_create_users.up.mysql.sql": {Data: []byte("CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR(40), nickname VARCHAR(40));")},
+		"migrations/002_alter_users.up.mysql.sql": {Data: []byte(database.OnlineSchemaChangeMarker + `
+ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 18, DROP COLUMN nickname, ADD INDEX users_age (age);
+`)},
+		"migrations/003_create_orders.up.mysql.sql": {Data: []byte("CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, CONSTRAINT orders_user FOREIGN KEY (user_id) REFERENCES users (id));")},
+		"migrations/004_alter_users.up.mysql.sql": {Data: []byte(database.OnlineSchemaChangeMarker + `
+ALTER TABLE users MODIFY name VARCHAR(80);
+`)},
+	})
+	err = database.RunMigrationsContext(ctx, logger, mysqlConfig, migrations, database.WithOnlineSchemaChanges(database.OnlineSchemaChangeConfig{}))
+	require.ErrorContains(t, err, "don't support tables with foreign keys, found orders_user (orders references users)")
+}
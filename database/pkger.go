@@ -1,96 +1,16 @@
 package database
 
 import (
-	"fmt"
-	"io"
-	"os"
-	"strings"
-
 	"github.com/golang-migrate/migrate/v4/source"
-	mpkger "github.com/golang-migrate/migrate/v4/source/pkger"
-	"github.com/markbates/pkger"
-	"github.com/markbates/pkger/pkging/mem"
+
+	"github.com/moov-io/base/pkgerfs"
 )
 
 const MIGRATIONS_DIR = "/migrations/"
 
+// NewPkgerSource reads the migrations packed by pkger.
+//
+// Deprecated: pkger is archived. Use NewFSSource or WithMigrationsFS with an embed.FS instead.
 func NewPkgerSource(database string, allowGeneric bool) (source.Driver, error) {
-	database = strings.ToLower(database)
-
-	hereInfo, err := pkger.Current()
-	if err != nil {
-		return nil, err
-	}
-
-	pmem, err := mem.New(hereInfo)
-	if err != nil {
-		return nil, err
-	}
-
-	pmem.MkdirAll(MIGRATIONS_DIR, 0755)
-
-	err = pkger.Walk(MIGRATIONS_DIR, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		splits := strings.Split(info.Name(), ".")
-		slen := len(splits)
-		if slen < 3 {
-			return fmt.Errorf("doesn't follow format of {version}_{title}.up{.db}?.sql - %s", info.Name())
-		}
-
-		if splits[slen-1] != "sql" {
-			return fmt.Errorf("must end in .sql")
-		}
-
-		var run bool
-		switch splits[slen-2] {
-		case "up":
-			run = true && allowGeneric
-		case "down":
-			run = true && allowGeneric
-		case database:
-			run = true
-		default:
-			run = false
-		}
-
-		if !run {
-			return nil
-		}
-
-		cur, err := pkger.Open(MIGRATIONS_DIR + info.Name())
-		if err != nil {
-			return err
-		}
-
-		nw, err := pmem.Create(path)
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(nw, cur)
-		if err != nil {
-			return err
-		}
-
-		nw.Close()
-
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("walking the migrations directory: %w", err)
-	}
-
-	drv, err := mpkger.WithInstance(pmem, MIGRATIONS_DIR)
-	if err != nil {
-		return nil, fmt.Errorf("unable to instantiate driver - %w", err)
-	}
-
-	return drv, nil
+	return NewFSSource(pkgerfs.FS, MIGRATIONS_DIR, database, allowGeneric)
 }
@@ -18,8 +18,9 @@ import (
 const (
 	// PostgreSQL Error Codes
 	// https://www.postgresql.org/docs/current/errcodes-appendix.html
-	postgresErrUniqueViolation = "23505"
-	postgresErrDeadlockFound   = "40P01"
+	postgresErrUniqueViolation      = "23505"
+	postgresErrDeadlockFound        = "40P01"
+	postgresErrSerializationFailure = "40001"
 )
 
 func postgresConnection(ctx context.Context, logger log.Logger, config PostgresConfig, databaseName string) (*sql.DB, error) {
@@ -164,3 +165,18 @@ func PostgresDeadlockFound(err error) bool {
 
 	return strings.Contains(err.Error(), postgresErrDeadlockFound)
 }
+
+// PostgresSerializationFailure returns true when the provided error matches the Postgres code
+// for a serialization failure, which happens when concurrent transactions conflict.
+func PostgresSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) && pgError.Code == postgresErrSerializationFailure {
+		return true
+	}
+
+	return strings.Contains(err.Error(), postgresErrSerializationFailure)
+}
@@ -0,0 +1,403 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kitprom "github.com/go-kit/kit/metrics/prometheus"
+	gomysql "github.com/go-sql-driver/mysql"
+	stdprom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/moov-io/base/log"
+)
+
+var (
+	routerQueries = kitprom.NewCounterFrom(stdprom.CounterOpts{
+		Name: "database_router_queries",
+		Help: "How many queries a Router sent to the primary and to replicas.",
+	}, []string{"target", "reason"})
+
+	routerReplicaLag = kitprom.NewGaugeFrom(stdprom.GaugeOpts{
+		Name: "database_replica_lag_seconds",
+		Help: "How far behind the primary each replica was at its last health check.",
+	}, []string{"replica"})
+
+	routerReplicaHealthy = kitprom.NewGaugeFrom(stdprom.GaugeOpts{
+		Name: "database_replica_healthy",
+		Help: "If each replica passed its last health check (1) or not (0).",
+	}, []string{"replica"})
+)
+
+// Replica is a read-only copy of the primary database.
+type Replica struct {
+	Name string
+	DB   *sql.DB
+}
+
+// LagFunc returns how far behind the primary a replica is.
+type LagFunc func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+// Router sends reads to healthy replicas in turn and everything else to the primary.
+//
+// QueryContext and QueryRowContext use a replica unless the context was created with WithPrimary.
+// ExecContext, PrepareContext and BeginTx (and so every transaction) use the primary.
+type Router struct {
+	logger  log.Logger
+	primary *sql.DB
+
+	replicas []*replica
+	next     atomic.Uint64
+
+	cfg ReplicaConfig
+	lag LagFunc
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	close  sync.Once
+}
+
+type replica struct {
+	Replica
+	healthy atomic.Bool
+}
+
+type primaryContextKey struct{}
+
+// WithPrimary pins reads made with ctx to the primary, such as reads which must see a write just made.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func pinnedToPrimary(ctx context.Context) bool {
+	pinned, _ := ctx.Value(primaryContextKey{}).(bool)
+	return pinned
+}
+
+// NewRouter connects to the primary database in config and each of its replicas.
+func NewRouter(ctx context.Context, logger log.Logger, config DatabaseConfig) (*Router, error) {
+	var (
+		replicaCfg *ReplicaConfig
+		lag        LagFunc
+	)
+	switch {
+	case config.MySQL != nil:
+		replicaCfg, lag = config.MySQL.Replicas, MySQLReplicaLag
+	case config.Postgres != nil:
+		replicaCfg, lag = config.Postgres.Replicas, PostgresReplicaLag
+	default:
+		return nil, errors.New("replicas are only supported for mysql and postgres")
+	}
+	if replicaCfg == nil {
+		replicaCfg = &ReplicaConfig{}
+	}
+
+	primary, err := New(ctx, logger, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []Replica
+	for _, address := range replicaCfg.Addresses {
+		db, err := New(ctx, logger.Set("replica", log.String(address)), replicaConfig(config, address))
+		if err != nil {
+			_ = primary.Close()
+			for _, r := range replicas {
+				_ = r.DB.Close()
+			}
+			return nil, fmt.Errorf("connecting to replica %s: %w", address, err)
+		}
+		replicas = append(replicas, Replica{Name: address, DB: db})
+	}
+
+	return NewReplicaRouter(logger, primary, replicas, *replicaCfg, lag), nil
+}
+
+// replicaConfig returns config with the primary address replaced by address.
+func replicaConfig(config DatabaseConfig, address string) DatabaseConfig {
+	if config.MySQL != nil {
+		mysql := *config.MySQL
+		mysql.Address, mysql.Replicas = address, nil
+		config.MySQL = &mysql
+	}
+	if config.Postgres != nil {
+		postgres := *config.Postgres
+		postgres.Address, postgres.Replicas = address, nil
+		config.Postgres = &postgres
+	}
+	return config
+}
+
+// NewReplicaRouter returns a Router over existing connections and checks the health of each replica
+// every cfg.HealthCheckInterval. lag can be nil to skip lag checks.
+func NewReplicaRouter(logger log.Logger, primary *sql.DB, replicas []Replica, cfg ReplicaConfig, lag LagFunc) *Router {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Router{
+		logger:  logger,
+		primary: primary,
+		cfg:     cfg,
+		lag:     lag,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	for i, rep := range replicas {
+		if rep.Name == "" {
+			rep.Name = strconv.Itoa(i)
+		}
+		added := &replica{Replica: rep}
+		added.healthy.Store(true) // until the first check says otherwise
+		r.replicas = append(r.replicas, added)
+	}
+
+	r.CheckReplicas(ctx)
+	go r.run(ctx)
+
+	return r
+}
+
+// Primary returns the primary database.
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+func (r *Router) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rep, reason := r.reader(ctx)
+	if rep != nil {
+		rows, err := rep.DB.QueryContext(ctx, query, args...) //nolint:sqlclosecheck
+		if err == nil || !r.unavailable(ctx, rep) {
+			routerQueries.With("target", "replica", "reason", reason).Add(1)
+			return rows, err
+		}
+		reason = "fallback"
+	}
+
+	routerQueries.With("target", "primary", "reason", reason).Add(1)
+	return r.primary.QueryContext(ctx, query, args...) //nolint:sqlclosecheck
+}
+
+func (r *Router) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	rep, reason := r.reader(ctx)
+	if rep != nil {
+		row := rep.DB.QueryRowContext(ctx, query, args...)
+		if row.Err() == nil || !r.unavailable(ctx, rep) {
+			routerQueries.With("target", "replica", "reason", reason).Add(1)
+			return row
+		}
+		reason = "fallback"
+	}
+
+	routerQueries.With("target", "primary", "reason", reason).Add(1)
+	return r.primary.QueryRowContext(ctx, query, args...)
+}
+
+func (r *Router) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	routerQueries.With("target", "primary", "reason", "write").Add(1)
+	return r.primary.ExecContext(ctx, query, args...)
+}
+
+func (r *Router) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	routerQueries.With("target", "primary", "reason", "prepare").Add(1)
+	return r.primary.PrepareContext(ctx, query)
+}
+
+func (r *Router) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	routerQueries.With("target", "primary", "reason", "tx").Add(1)
+	return r.primary.BeginTx(ctx, opts)
+}
+
+// Close stops health checks and closes the primary and replica connections.
+func (r *Router) Close() error {
+	var errs []error
+	r.close.Do(func() {
+		r.cancel()
+		<-r.done
+
+		errs = append(errs, r.primary.Close())
+		for _, rep := range r.replicas {
+			errs = append(errs, rep.DB.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// reader picks the next healthy replica, or returns nil and why the primary should be used instead.
+func (r *Router) reader(ctx context.Context) (*replica, string) {
+	if pinnedToPrimary(ctx) {
+		return nil, "pinned"
+	}
+	if len(r.replicas) == 0 {
+		return nil, "no_replicas"
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.healthy.Load() {
+			return rep, "read"
+		}
+	}
+	return nil, "no_healthy_replicas"
+}
+
+// unavailable checks a replica after a failed query and marks it unhealthy when it can't be reached.
+func (r *Router) unavailable(ctx context.Context, rep *replica) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := rep.DB.PingContext(pingCtx); err != nil {
+		r.setHealthy(rep, false, err)
+		return true
+	}
+	return false
+}
+
+func (r *Router) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckReplicas(ctx)
+		}
+	}
+}
+
+// CheckReplicas pings each replica and compares its lag against ReplicaConfig.MaxLag.
+// Health checks run in the background, so this is only needed to see changes sooner.
+func (r *Router) CheckReplicas(ctx context.Context) {
+	for _, rep := range r.replicas {
+		err := r.checkReplica(ctx, rep)
+		r.setHealthy(rep, err == nil, err)
+	}
+}
+
+func (r *Router) checkReplica(ctx context.Context, rep *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.HealthCheckInterval)
+	defer cancel()
+
+	if err := rep.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	if r.lag == nil || r.cfg.MaxLag <= 0 {
+		return nil
+	}
+
+	lag, err := r.lag(ctx, rep.DB)
+	if err != nil {
+		return fmt.Errorf("checking lag: %w", err)
+	}
+	routerReplicaLag.With("replica", rep.Name).Set(lag.Seconds())
+
+	if lag > r.cfg.MaxLag {
+		return fmt.Errorf("lag of %v is over %v", lag, r.cfg.MaxLag)
+	}
+	return nil
+}
+
+func (r *Router) setHealthy(rep *replica, healthy bool, err error) {
+	if rep.healthy.Swap(healthy) != healthy {
+		logger := r.logger.Set("replica", log.String(rep.Name))
+		if healthy {
+			logger.Info().Log("replica is healthy")
+		} else {
+			logger.Warn().LogErrorf("replica is unhealthy: %w", err)
+		}
+	}
+
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	routerReplicaHealthy.With("replica", rep.Name).Set(value)
+}
+
+// MySQLReplicaLag reads Seconds_Behind_Source from SHOW REPLICA STATUS, which needs MySQL 8.0.22
+// or later. Older versions fall back to Seconds_Behind_Master from SHOW SLAVE STATUS. Databases
+// which aren't replicas have no lag.
+func MySQLReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if mysqlSyntaxError(err) {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errors.New("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %w", column, err)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replica status is missing Seconds_Behind_Source")
+}
+
+// mysqlSyntaxError reports if MySQL couldn't parse a statement, such as SHOW REPLICA STATUS before 8.0.22.
+func mysqlSyntaxError(err error) bool {
+	var mysqlErr *gomysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrParse
+}
+
+// PostgresReplicaLag returns how long ago the last replayed transaction was committed on the primary.
+// Databases which aren't in recovery or have replayed all the WAL they received have no lag, as the
+// last transaction gets older while the primary is idle.
+func PostgresReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	qry := `SELECT CASE WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`
+
+	var seconds float64
+	if err := db.QueryRowContext(ctx, qry).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,143 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+// openNamedDatabase returns a SQLite database whose source table holds name
+func openNamedDatabase(t *testing.T, name string) *sql.DB {
+	t.Helper()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	db, err := database.New(context.Background(), log.NewTestLogger(), config)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`CREATE TABLE source (name TEXT)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO source (name) VALUES (?)`, name)
+	require.NoError(t, err)
+
+	return db
+}
+
+func readSource(t *testing.T, ctx context.Context, router *database.Router) string {
+	t.Helper()
+
+	var name string
+	require.NoError(t, router.QueryRowContext(ctx, `SELECT name FROM source`).Scan(&name))
+	return name
+}
+
+func TestRouter(t *testing.T) {
+	ctx := context.Background()
+
+	router := database.NewReplicaRouter(log.NewTestLogger(), openNamedDatabase(t, "primary"), []database.Replica{
+		{Name: "r1", DB: openNamedDatabase(t, "r1")},
+		{Name: "r2", DB: openNamedDatabase(t, "r2")},
+	}, database.ReplicaConfig{}, nil)
+	t.Cleanup(func() { router.Close() })
+
+	// Reads alternate between replicas
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[readSource(t, ctx, router)]++
+	}
+	require.Equal(t, map[string]int{"r1": 2, "r2": 2}, seen)
+
+	rows, err := router.QueryContext(ctx, `SELECT name FROM source`)
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	var name string
+	require.NoError(t, rows.Scan(&name))
+	require.Contains(t, []string{"r1", "r2"}, name)
+	require.NoError(t, rows.Close())
+
+	// Pinned reads, writes and transactions use the primary
+	require.Equal(t, "primary", readSource(t, database.WithPrimary(ctx), router))
+
+	_, err = router.ExecContext(ctx, `UPDATE source SET name = 'primary-updated'`)
+	require.NoError(t, err)
+	require.Equal(t, "primary-updated", readSource(t, database.WithPrimary(ctx), router))
+
+	tx, err := router.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.QueryRowContext(ctx, `SELECT name FROM source`).Scan(&name))
+	require.Equal(t, "primary-updated", name)
+	require.NoError(t, tx.Rollback())
+}
+
+func TestRouter_Health(t *testing.T) {
+	ctx := context.Background()
+
+	r1 := openNamedDatabase(t, "r1")
+	r2 := openNamedDatabase(t, "r2")
+
+	var r2Lag atomic.Int64
+	lag := func(ctx context.Context, db *sql.DB) (time.Duration, error) {
+		if db == r2 {
+			return time.Duration(r2Lag.Load()), nil
+		}
+		return 0, nil
+	}
+
+	router := database.NewReplicaRouter(log.NewTestLogger(), openNamedDatabase(t, "primary"), []database.Replica{
+		{Name: "r1", DB: r1},
+		{Name: "r2", DB: r2},
+	}, database.ReplicaConfig{
+		MaxLag:              time.Second,
+		HealthCheckInterval: time.Hour,
+	}, lag)
+	t.Cleanup(func() { router.Close() })
+
+	// Lagging replicas are skipped
+	r2Lag.Store(int64(time.Minute))
+	router.CheckReplicas(ctx)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, "r1", readSource(t, ctx, router))
+	}
+
+	// Unreachable replicas fall back to the primary and are skipped afterwards
+	r2Lag.Store(0)
+	router.CheckReplicas(ctx)
+	require.NoError(t, r1.Close())
+	for i := 0; i < 3; i++ {
+		require.Contains(t, []string{"primary", "r2"}, readSource(t, ctx, router))
+	}
+	require.Equal(t, "r2", readSource(t, ctx, router))
+
+	// Without healthy replicas reads use the primary
+	r2Lag.Store(int64(time.Minute))
+	router.CheckReplicas(ctx)
+	require.Equal(t, "primary", readSource(t, ctx, router))
+}
+
+func TestRouter_Errors(t *testing.T) {
+	_, err := database.NewRouter(context.Background(), log.NewTestLogger(), database.DatabaseConfig{})
+	require.Error(t, err)
+
+	router := database.NewReplicaRouter(nil, openNamedDatabase(t, "primary"), []database.Replica{
+		{DB: openNamedDatabase(t, "r1")},
+	}, database.ReplicaConfig{}, func(ctx context.Context, db *sql.DB) (time.Duration, error) {
+		return 0, errors.New("unused without MaxLag")
+	})
+
+	// Query errors from a reachable replica are returned as is
+	_, err = router.QueryContext(context.Background(), `SELECT missing FROM source`)
+	require.ErrorContains(t, err, "no such column")
+
+	require.NoError(t, router.Close())
+	require.NoError(t, router.Close())
+}
@@ -41,3 +41,12 @@ func SpannerUniqueViolation(err error) bool {
 	return spanner.ErrCode(err) == codes.AlreadyExists ||
 		strings.Contains(err.Error(), "AlreadyExists")
 }
+
+// SpannerAborted returns true when the provided error matches the Spanner code for an
+// aborted transaction, which should be retried.
+func SpannerAborted(err error) bool {
+	if err == nil {
+		return false
+	}
+	return spanner.ErrCode(err) == codes.Aborted
+}
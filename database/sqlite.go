@@ -0,0 +1,168 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	migsqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/moov-io/base/log"
+)
+
+// SQLiteMemory is the SQLiteConfig.Path for a database kept in memory.
+const SQLiteMemory = ":memory:"
+
+var (
+	// sqliteMemoryDatabases keeps a connection open to each named in-memory database so it
+	// lives until CloseSQLiteMemoryDatabase rather than until its last *sql.DB is closed.
+	sqliteMemoryDatabases   = make(map[string]*sql.DB)
+	sqliteMemoryDatabasesMu sync.Mutex
+)
+
+func sqliteConnection(logger log.Logger, config SQLiteConfig, databaseName string) (*sql.DB, error) {
+	dsn, err := sqliteDSN(config, databaseName)
+	if err != nil {
+		return nil, logger.LogErrorf("creating sqlite connection: %w", err).Err()
+	}
+
+	if config.Path == SQLiteMemory {
+		if err := keepSQLiteMemoryDatabase(dsn); err != nil {
+			return nil, logger.LogErrorf("opening in-memory database: %w", err).Err()
+		}
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, logger.LogErrorf("opening database: %w", err).Err()
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, logger.LogErrorf("connecting to database: %w", err).Err()
+	}
+
+	return db, nil
+}
+
+func sqliteDSN(config SQLiteConfig, databaseName string) (string, error) {
+	params := url.Values{}
+
+	path := config.Path
+	if path == SQLiteMemory {
+		if databaseName == "" {
+			return "", errors.New("database name is required for in-memory databases")
+		}
+		// Connections share one in-memory database per name
+		path = databaseName
+		params.Set("mode", "memory")
+		params.Set("cache", "shared")
+	}
+	if config.JournalMode != "" {
+		params.Add("_pragma", fmt.Sprintf("journal_mode(%s)", strings.ToUpper(config.JournalMode)))
+	}
+	if config.BusyTimeout > 0 {
+		params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", config.BusyTimeout.Milliseconds()))
+	}
+
+	dsn := "file:" + path
+	if len(params) > 0 {
+		dsn += "?" + params.Encode()
+	}
+	return dsn, nil
+}
+
+func keepSQLiteMemoryDatabase(dsn string) error {
+	sqliteMemoryDatabasesMu.Lock()
+	defer sqliteMemoryDatabasesMu.Unlock()
+
+	if _, exists := sqliteMemoryDatabases[dsn]; exists {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return err
+	}
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return err
+	}
+
+	sqliteMemoryDatabases[dsn] = db
+	return nil
+}
+
+// CloseSQLiteMemoryDatabase frees the in-memory database of config once the *sql.DB handles
+// using it are closed. Configs which aren't in-memory databases are ignored.
+func CloseSQLiteMemoryDatabase(config DatabaseConfig) error {
+	if config.SQLite == nil || config.SQLite.Path != SQLiteMemory {
+		return nil
+	}
+	dsn, err := sqliteDSN(*config.SQLite, config.DatabaseName)
+	if err != nil {
+		return err
+	}
+
+	sqliteMemoryDatabasesMu.Lock()
+	defer sqliteMemoryDatabasesMu.Unlock()
+
+	db, exists := sqliteMemoryDatabases[dsn]
+	if !exists {
+		return nil
+	}
+	delete(sqliteMemoryDatabases, dsn)
+	return db.Close()
+}
+
+func SQLiteDriver(db *sql.DB) (database.Driver, error) {
+	return migsqlite.WithInstance(db, &migsqlite.Config{})
+}
+
+// SQLiteUniqueViolation returns true when the provided error matches the SQLite code
+// for unique or primary key constraint violations.
+func SQLiteUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+			sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// SQLiteDeadlockFound returns true when the provided error matches the SQLite codes for a
+// busy database or locked table. SQLite doesn't detect deadlocks, but these errors are retried
+// the same way.
+func SQLiteDeadlockFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// Extended codes such as SQLITE_BUSY_SNAPSHOT keep the primary code in the low byte
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+
+	return strings.Contains(err.Error(), "database is locked") ||
+		strings.Contains(err.Error(), "database table is locked")
+}
@@ -0,0 +1,118 @@
+package database_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+func TestSQLite_Migrations(t *testing.T) {
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	db, err := database.NewAndMigrate(context.Background(), log.NewTestLogger(), config, database.WithEmbeddedMigrations(base.SQLiteMigrations))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO tests (id) VALUES ('a')`)
+	require.NoError(t, err)
+
+	var journal string
+	require.NoError(t, db.QueryRow(`PRAGMA journal_mode`).Scan(&journal))
+	require.Equal(t, "wal", journal)
+
+	var timeout int
+	require.NoError(t, db.QueryRow(`PRAGMA busy_timeout`).Scan(&timeout))
+	require.Equal(t, 5000, timeout)
+
+	// Running again leaves the database as is
+	require.NoError(t, database.RunMigrations(log.NewTestLogger(), config, database.WithEmbeddedMigrations(base.SQLiteMigrations)))
+}
+
+func TestSQLite_Memory(t *testing.T) {
+	config, err := testdb.NewSQLiteDatabase(t, &database.SQLiteConfig{
+		Path: database.SQLiteMemory,
+	})
+	require.NoError(t, err)
+
+	// Migrations run on their own connection, so the tables must outlive it
+	db, err := database.NewAndMigrate(context.Background(), log.NewTestLogger(), config, database.WithEmbeddedMigrations(base.SQLiteMigrations))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO tests (id) VALUES ('a')`)
+	require.NoError(t, err)
+
+	// Other databases are separate
+	other, err := testdb.NewSQLiteDatabase(t, &database.SQLiteConfig{
+		Path: database.SQLiteMemory,
+	})
+	require.NoError(t, err)
+
+	otherDB, err := database.New(context.Background(), log.NewTestLogger(), other)
+	require.NoError(t, err)
+	defer otherDB.Close()
+
+	_, err = otherDB.Exec(`SELECT id FROM tests`)
+	require.ErrorContains(t, err, "no such table")
+
+	// Closing frees the database once its handles are closed
+	require.NoError(t, database.CloseSQLiteMemoryDatabase(config))
+	require.NoError(t, db.Close())
+
+	db, err = database.New(context.Background(), log.NewTestLogger(), config)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`SELECT id FROM tests`)
+	require.ErrorContains(t, err, "no such table")
+}
+
+func TestSQLite_Errors(t *testing.T) {
+	config, err := testdb.NewSQLiteDatabase(t, &database.SQLiteConfig{
+		Path:        filepath.Join(t.TempDir(), "errors.db"),
+		BusyTimeout: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	db, err := database.New(context.Background(), log.NewTestLogger(), config)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE uniques (id TEXT PRIMARY KEY, name TEXT UNIQUE)`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO uniques (id, name) VALUES ('a', 'one')`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO uniques (id, name) VALUES ('a', 'two')`)
+	require.True(t, database.UniqueViolation(err))
+
+	_, err = db.Exec(`INSERT INTO uniques (id, name) VALUES ('b', 'one')`)
+	require.True(t, database.UniqueViolation(err))
+	require.False(t, database.DeadlockFound(err))
+
+	// Hold a write lock from a second connection
+	locker, err := database.New(context.Background(), log.NewTestLogger(), config)
+	require.NoError(t, err)
+	defer locker.Close()
+
+	tx, err := locker.Begin()
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO uniques (id, name) VALUES ('c', 'three')`)
+	require.NoError(t, err)
+
+	_, err = db.Exec(`INSERT INTO uniques (id, name) VALUES ('d', 'four')`)
+	require.Error(t, err)
+	require.True(t, database.DeadlockFound(err))
+	require.False(t, database.UniqueViolation(err))
+}
@@ -0,0 +1,62 @@
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/log"
+)
+
+// NewMigratedDatabase creates a new database for dialect, which is "mysql", "postgres" or "sqlite",
+// and runs the migrations from the migrations directory of fsys. MySQL and Postgres are expected
+// on the ports and credentials of docker-compose.yml. The returned *sql.DB is closed once the test completes.
+func NewMigratedDatabase(t *testing.T, dialect string, fsys fs.FS) (*sql.DB, database.DatabaseConfig, error) {
+	t.Helper()
+
+	var (
+		cfg database.DatabaseConfig
+		err error
+	)
+	switch dialect {
+	case "mysql":
+		cfg = database.DatabaseConfig{
+			DatabaseName: "mysql" + base.ID(),
+			MySQL: &database.MySQLConfig{
+				Address:  "tcp(127.0.0.1:3306)",
+				User:     "root",
+				Password: "root",
+			},
+		}
+		err = NewMySQLDatabase(t, cfg)
+	case "postgres":
+		cfg = database.DatabaseConfig{
+			DatabaseName: "postgres" + base.ID(),
+			Postgres: &database.PostgresConfig{
+				Address:  "127.0.0.1:5432",
+				User:     "moov",
+				Password: "moov",
+			},
+		}
+		err = NewPostgresDatabase(t, cfg)
+	case "sqlite":
+		cfg, err = NewSQLiteDatabase(t, nil)
+	default:
+		err = fmt.Errorf("unknown database %q", dialect)
+	}
+	if err != nil {
+		return nil, cfg, err
+	}
+
+	db, err := database.NewAndMigrate(context.Background(), log.NewTestLogger(), cfg, database.WithMigrationsFS(fsys))
+	if err != nil {
+		return nil, cfg, err
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, cfg, nil
+}
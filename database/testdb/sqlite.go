@@ -0,0 +1,43 @@
+package testdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/log"
+)
+
+// NewSQLiteDatabase returns the config for a new SQLite database. When sqliteCfg is nil the database
+// is a file in a temporary directory, using WAL journaling, which is removed once the test completes.
+// In-memory databases are freed once the test completes.
+func NewSQLiteDatabase(t *testing.T, sqliteCfg *database.SQLiteConfig) (database.DatabaseConfig, error) {
+	t.Helper()
+
+	databaseName := "sqlite" + base.ID()
+	if sqliteCfg == nil {
+		sqliteCfg = &database.SQLiteConfig{
+			Path:        filepath.Join(t.TempDir(), databaseName+".db"),
+			JournalMode: "wal",
+			BusyTimeout: 5 * time.Second,
+		}
+	}
+
+	cfg := database.DatabaseConfig{
+		DatabaseName: databaseName,
+		SQLite:       sqliteCfg,
+	}
+
+	// Create the database so problems are found early
+	db, err := database.New(context.Background(), log.NewTestLogger(), cfg)
+	if err != nil {
+		return cfg, err
+	}
+	t.Cleanup(func() {
+		database.CloseSQLiteMemoryDatabase(cfg)
+	})
+	return cfg, db.Close()
+}
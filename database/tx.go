@@ -3,8 +3,89 @@
 // license that can be found in the LICENSE file.
 package database
 
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/moov-io/base/ratex"
+)
+
 type RunInTx func() error
 
 func NopInTx() error {
 	return nil
 }
+
+// TxOptions configures a transaction started by InTx.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	// Retries controls how many times InTx runs the closure again after a retryable error,
+	// typically DatabaseConfig.Retries. A nil RetryConfig runs the closure once.
+	Retries *RetryConfig
+}
+
+// InTx runs fn inside a transaction which is committed when fn returns nil and rolled back otherwise.
+// Panics within fn roll back the transaction and are returned as an error.
+//
+// When the transaction fails with a deadlock, a Postgres serialization failure or an aborted Spanner
+// transaction the whole closure is retried according to opts.Retries, so fn must be safe to run again.
+func InTx(ctx context.Context, db *sql.DB, opts TxOptions, fn func(tx *sql.Tx) error) error {
+	params := ratex.RetryParams{
+		ShouldRetry: RetryableTxError,
+		MaxAttempts: 1,
+	}
+	if opts.Retries != nil {
+		params.MaxAttempts = opts.Retries.MaxAttempts
+		params.MinDuration = opts.Retries.MinDuration
+		params.MaxDuration = opts.Retries.MaxDuration
+	}
+
+	_, err := ratex.ExecRetryable(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, runTx(ctx, db, opts, fn)
+	}, params)
+	return err
+}
+
+// RetryableTxError returns true when err means the transaction was aborted by the database
+// and can be run again.
+func RetryableTxError(err error) bool {
+	return DeadlockFound(err) || PostgresSerializationFailure(err) || SpannerAborted(err)
+}
+
+func runTx(ctx context.Context, db *sql.DB, opts TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+
+			if e, ok := r.(error); ok {
+				err = fmt.Errorf("recovered from panic in transaction: %w", e)
+			} else {
+				err = fmt.Errorf("recovered from panic in transaction: %v", r)
+			}
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return errors.Join(err, fmt.Errorf("rolling back transaction: %w", rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+)
+
+func setupTxDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+
+	config, err := testdb.NewSQLiteDatabase(t, nil)
+	require.NoError(t, err)
+
+	db, err := database.New(context.Background(), log.NewTestLogger(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE items (id TEXT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	return db
+}
+
+func countItems(t *testing.T, db *sql.DB) int {
+	t.Helper()
+
+	var n int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&n))
+	return n
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+	db := setupTxDatabase(t)
+
+	err := database.InTx(ctx, db, database.TxOptions{}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO items (id) VALUES ('a')`)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, countItems(t, db))
+
+	// Errors roll back
+	boom := errors.New("boom")
+	err = database.InTx(ctx, db, database.TxOptions{}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO items (id) VALUES ('b')`)
+		require.NoError(t, err)
+		return boom
+	})
+	require.ErrorIs(t, err, boom)
+	require.Equal(t, 1, countItems(t, db))
+
+	// Panics roll back
+	err = database.InTx(ctx, db, database.TxOptions{}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO items (id) VALUES ('c')`)
+		require.NoError(t, err)
+		panic("unexpected")
+	})
+	require.ErrorContains(t, err, "recovered from panic in transaction: unexpected")
+	require.Equal(t, 1, countItems(t, db))
+}
+
+func TestInTx_Retries(t *testing.T) {
+	ctx := context.Background()
+	db := setupTxDatabase(t)
+
+	opts := database.TxOptions{
+		Retries: &database.RetryConfig{
+			MaxAttempts: 3,
+			MinDuration: time.Millisecond,
+			MaxDuration: 2 * time.Millisecond,
+		},
+	}
+
+	var attempts int
+	err := database.InTx(ctx, db, opts, func(tx *sql.Tx) error {
+		attempts++
+
+		_, err := tx.Exec(`INSERT INTO items (id) VALUES ('a')`)
+		require.NoError(t, err)
+
+		if attempts < 3 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 1, countItems(t, db))
+
+	// Give up after MaxAttempts
+	attempts = 0
+	err = database.InTx(ctx, db, opts, func(tx *sql.Tx) error {
+		attempts++
+		return &pgconn.PgError{Code: "40P01"}
+	})
+	require.ErrorContains(t, err, "hit max tries 3")
+	require.Equal(t, 3, attempts)
+
+	// Other errors aren't retried
+	attempts = 0
+	err = database.InTx(ctx, db, opts, func(tx *sql.Tx) error {
+		attempts++
+		return errors.New("bad input")
+	})
+	require.EqualError(t, err, "bad input")
+	require.Equal(t, 1, attempts)
+}
+
+func TestRetryableTxError(t *testing.T) {
+	require.True(t, database.RetryableTxError(&pgconn.PgError{Code: "40001"}))
+	require.True(t, database.RetryableTxError(&pgconn.PgError{Code: "40P01"}))
+	require.True(t, database.RetryableTxError(spanner.ToSpannerError(status.Error(codes.Aborted, "transaction aborted"))))
+	require.False(t, database.RetryableTxError(&pgconn.PgError{Code: "23505"}))
+	require.False(t, database.RetryableTxError(nil))
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/moov-io/base/database"
+)
+
+// Migrations holds the migrations which create the idempotency_keys table, named
+// migrations/001_create_idempotency_keys.{up,down}.{mysql,postgres,spanner,sqlite}.sql. Copy the files
+// for your database into your application's migrations, renumbered to follow them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+// DatabaseStore keeps records in the idempotency_keys table.
+type DatabaseStore struct {
+	db          *sql.DB
+	placeholder func(i int) string
+}
+
+// NewDatabaseStore returns a Store using the idempotency_keys table in db. See Migrations.
+func NewDatabaseStore(db *sql.DB, config database.DatabaseConfig) (*DatabaseStore, error) {
+	s := &DatabaseStore{
+		db:          db,
+		placeholder: func(int) string { return "?" },
+	}
+	switch {
+	case config.Postgres != nil:
+		s.placeholder = func(i int) string { return fmt.Sprintf("$%d", i) }
+	case config.MySQL != nil, config.Spanner != nil, config.SQLite != nil:
+	default:
+		return nil, errors.New("database config not defined")
+	}
+	return s, nil
+}
+
+func (s *DatabaseStore) Reserve(ctx context.Context, rec Record) (*Record, error) {
+	// Make way for the new reservation when the existing one expired or was abandoned
+	now := time.Now().UTC()
+	qry := fmt.Sprintf(`DELETE FROM idempotency_keys WHERE user_id = %s AND idempotency_key = %s
+AND (expires_at < %s OR (status_code IS NULL AND locked_until < %s))`, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	_, err := s.db.ExecContext(ctx, qry, rec.Key.UserID, rec.Key.Key, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("removing replaceable idempotency key: %w", err)
+	}
+
+	qry = fmt.Sprintf(`INSERT INTO idempotency_keys (user_id, idempotency_key, token, fingerprint, created_at, locked_until, expires_at)
+VALUES (%s, %s, %s, %s, %s, %s, %s)`, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5), s.placeholder(6), s.placeholder(7))
+	_, err = s.db.ExecContext(ctx, qry, rec.Key.UserID, rec.Key.Key, rec.Token, rec.Fingerprint,
+		rec.CreatedAt.UTC(), rec.LockedUntil.UTC(), rec.ExpiresAt.UTC())
+	if err == nil {
+		return nil, nil
+	}
+	if !database.UniqueViolation(err) {
+		return nil, fmt.Errorf("reserving idempotency key: %w", err)
+	}
+
+	existing, err := s.read(ctx, rec.Key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The existing record was removed since our insert, let the client retry
+		return nil, fmt.Errorf("idempotency key %s was released during reservation", rec.Key.Key)
+	}
+	return existing, err
+}
+
+func (s *DatabaseStore) read(ctx context.Context, key Key) (*Record, error) {
+	qry := fmt.Sprintf(`SELECT token, fingerprint, status_code, headers, body, created_at, locked_until, expires_at
+FROM idempotency_keys WHERE user_id = %s AND idempotency_key = %s`, s.placeholder(1), s.placeholder(2))
+
+	rec := Record{Key: key}
+	var statusCode sql.NullInt64
+	var headers sql.NullString
+	var body []byte
+	err := s.db.QueryRowContext(ctx, qry, key.UserID, key.Key).Scan(&rec.Token, &rec.Fingerprint, &statusCode, &headers, &body,
+		&rec.CreatedAt, &rec.LockedUntil, &rec.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode.Valid {
+		rec.Response = &Response{
+			StatusCode: int(statusCode.Int64),
+			Body:       body,
+		}
+		if headers.Valid && headers.String != "" {
+			if err := json.Unmarshal([]byte(headers.String), &rec.Response.Header); err != nil {
+				return nil, fmt.Errorf("decoding idempotency key response headers: %w", err)
+			}
+		}
+	}
+	return &rec, nil
+}
+
+func (s *DatabaseStore) Complete(ctx context.Context, key Key, token string, response Response) error {
+	if response.Header == nil {
+		response.Header = make(http.Header)
+	}
+	headers, err := json.Marshal(response.Header)
+	if err != nil {
+		return fmt.Errorf("encoding idempotency key response headers: %w", err)
+	}
+	if response.Body == nil {
+		response.Body = []byte{}
+	}
+
+	qry := fmt.Sprintf(`UPDATE idempotency_keys SET status_code = %s, headers = %s, body = %s
+WHERE user_id = %s AND idempotency_key = %s AND token = %s`, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4), s.placeholder(5), s.placeholder(6))
+	_, err = s.db.ExecContext(ctx, qry, response.StatusCode, string(headers), response.Body, key.UserID, key.Key, token)
+	if err != nil {
+		return fmt.Errorf("completing idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *DatabaseStore) Release(ctx context.Context, key Key, token string) error {
+	qry := fmt.Sprintf(`DELETE FROM idempotency_keys WHERE user_id = %s AND idempotency_key = %s AND token = %s AND status_code IS NULL`,
+		s.placeholder(1), s.placeholder(2), s.placeholder(3))
+	_, err := s.db.ExecContext(ctx, qry, key.UserID, key.Key, token)
+	if err != nil {
+		return fmt.Errorf("releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *DatabaseStore) Extend(ctx context.Context, key Key, token string, lockedUntil time.Time) error {
+	qry := fmt.Sprintf(`UPDATE idempotency_keys SET locked_until = %s
+WHERE user_id = %s AND idempotency_key = %s AND token = %s AND status_code IS NULL`, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	_, err := s.db.ExecContext(ctx, qry, lockedUntil.UTC(), key.UserID, key.Key, token)
+	if err != nil {
+		return fmt.Errorf("extending idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes expired records.
+func (s *DatabaseStore) Purge(ctx context.Context) (int64, error) {
+	qry := fmt.Sprintf(`DELETE FROM idempotency_keys WHERE expires_at < %s`, s.placeholder(1))
+	res, err := s.db.ExecContext(ctx, qry, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("purging idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
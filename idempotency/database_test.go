@@ -0,0 +1,27 @@
+package idempotency_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/idempotency"
+)
+
+func TestDatabaseStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short flag enabled")
+	}
+
+	for _, dialect := range []string{"mysql", "postgres"} {
+		t.Run(dialect, func(t *testing.T) {
+			db, config, err := testdb.NewMigratedDatabase(t, dialect, idempotency.Migrations)
+			require.NoError(t, err)
+			store, err := idempotency.NewDatabaseStore(db, config)
+			require.NoError(t, err)
+
+			testMiddleware(t, store)
+		})
+	}
+}
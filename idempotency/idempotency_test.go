@@ -0,0 +1,279 @@
+package idempotency_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/idempotency"
+	"github.com/moov-io/base/log"
+)
+
+func TestMiddleware_Memory(t *testing.T) {
+	testMiddleware(t, idempotency.NewMemoryStore())
+}
+
+func TestMiddleware_SQLite(t *testing.T) {
+	db, config, err := testdb.NewMigratedDatabase(t, "sqlite", idempotency.Migrations)
+	require.NoError(t, err)
+
+	store, err := idempotency.NewDatabaseStore(db, config)
+	require.NoError(t, err)
+
+	testMiddleware(t, store)
+
+	purged, err := store.Purge(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged)
+}
+
+type testServer struct {
+	*httptest.Server
+
+	calls   atomic.Int32
+	block   chan struct{}
+	started chan struct{}
+}
+
+func newTestServer(t *testing.T, store idempotency.Store, cfg idempotency.Config) *testServer {
+	t.Helper()
+
+	s := &testServer{}
+
+	router := mux.NewRouter()
+	router.Use(idempotency.Middleware(log.NewTestLogger(), store, cfg))
+	router.Methods("POST").Path("/transfers").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.calls.Add(1)
+		if s.block != nil {
+			s.started <- struct{}{}
+			<-s.block
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if string(body) == "panic" {
+			panic("handler failed")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/transfers/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"body":%q}`, n, body)
+	})
+	router.Methods("GET").Path("/transfers").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	s.Server = httptest.NewServer(router)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) do(t *testing.T, method, key, userID, body string) (*http.Response, string) {
+	t.Helper()
+	return s.doPath(t, method, "/transfers", key, userID, body)
+}
+
+func (s *testServer) doPath(t *testing.T, method, path, key, userID, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	if key != "" {
+		req.Header.Set(idempotency.HeaderName, key)
+	}
+	req.Header.Set("X-User-Id", userID)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(bs)
+}
+
+func testMiddleware(t *testing.T, store idempotency.Store) {
+	t.Helper()
+	server := newTestServer(t, store, idempotency.Config{})
+
+	resp, body := server.do(t, "POST", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, `{"id":1,"body":"amount=100"}`, body)
+	require.Empty(t, resp.Header.Get(idempotency.ReplayedHeader))
+
+	// Retries replay the first response
+	resp, body = server.do(t, "POST", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, `{"id":1,"body":"amount=100"}`, body)
+	require.Equal(t, "/transfers/1", resp.Header.Get("Location"))
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, "true", resp.Header.Get(idempotency.ReplayedHeader))
+	require.Equal(t, int32(1), server.calls.Load())
+
+	// Reusing a key for a different request is rejected
+	resp, body = server.do(t, "POST", "key-1", "user-1", "amount=200")
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Contains(t, body, "different request")
+	resp, body = server.doPath(t, "POST", "/transfers?dryRun=true", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Contains(t, body, "different request")
+
+	// Keys are scoped to each user
+	resp, body = server.do(t, "POST", "key-1", "user-2", "amount=200")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, `{"id":2,"body":"amount=200"}`, body)
+
+	// Requests without a key or with other methods aren't tracked
+	resp, _ = server.do(t, "POST", "", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = server.do(t, "GET", "key-1", "user-1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(4), server.calls.Load())
+
+	// Server errors and panics aren't stored so they can be retried
+	resp, _ = server.do(t, "POST", "key-2", "user-1", "fail")
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	resp, _ = server.do(t, "POST", "key-2", "user-1", "fail")
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, int32(6), server.calls.Load())
+
+	// Fresh connections keep the client from retrying the failed requests itself
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	_, err := client.Do(newRequest(t, server.URL, "key-3", "panic"))
+	require.Error(t, err)
+	_, err = client.Do(newRequest(t, server.URL, "key-3", "panic"))
+	require.Error(t, err)
+	require.Equal(t, int32(8), server.calls.Load())
+}
+
+func newRequest(t *testing.T, url, key, body string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", url+"/transfers", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set(idempotency.HeaderName, key)
+	req.Header.Set("X-User-Id", "user-1")
+	return req
+}
+
+func TestMiddleware_InFlight(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{})
+	server.block = make(chan struct{})
+	server.started = make(chan struct{})
+
+	first := make(chan *http.Response)
+	go func() {
+		resp, _ := server.do(t, "POST", "key-1", "user-1", "amount=100")
+		first <- resp
+	}()
+	<-server.started
+
+	// Duplicates of an in flight request conflict
+	resp, body := server.do(t, "POST", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+	require.Contains(t, body, "in progress")
+
+	close(server.block)
+	require.Equal(t, http.StatusCreated, (<-first).StatusCode)
+}
+
+func TestMiddleware_LockTimeout(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+
+	// An abandoned reservation, as if the process handling it crashed
+	_, err := store.Reserve(t.Context(), idempotency.Record{
+		Key:         idempotency.Key{UserID: "user-1", Key: "key-1"},
+		Token:       "abandoned",
+		LockedUntil: time.Now().Add(-time.Second),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	server := newTestServer(t, store, idempotency.Config{})
+	resp, _ := server.do(t, "POST", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestMiddleware_Required(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{Required: true})
+
+	resp, body := server.do(t, "POST", "", "user-1", "amount=100")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body, "missing Idempotency-Key header")
+
+	resp, body = server.do(t, "POST", strings.Repeat("a", 256), "user-1", "amount=100")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body, "longer than 255 characters")
+	require.Equal(t, int32(0), server.calls.Load())
+}
+
+func TestMiddleware_QueryOrder(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{})
+
+	resp, _ := server.doPath(t, "POST", "/transfers?a=1&b=2", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Query parameters are compared regardless of their order
+	resp, _ = server.doPath(t, "POST", "/transfers?b=2&a=1", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(idempotency.ReplayedHeader))
+	require.Equal(t, int32(1), server.calls.Load())
+}
+
+func TestMiddleware_Anonymous(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{})
+
+	resp, body := server.do(t, "POST", "key-1", "", "amount=100")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Contains(t, body, "requires an authenticated user")
+	require.Equal(t, int32(0), server.calls.Load())
+}
+
+func TestMiddleware_MaxBodyBytes(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{MaxBodyBytes: 10})
+
+	resp, body := server.do(t, "POST", "key-1", "user-1", strings.Repeat("a", 11))
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.Contains(t, body, "larger than 10 bytes")
+
+	resp, _ = server.do(t, "POST", "key-2", "user-1", strings.Repeat("a", 10))
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, int32(1), server.calls.Load())
+}
+
+func TestMiddleware_ExtendLock(t *testing.T) {
+	server := newTestServer(t, idempotency.NewMemoryStore(), idempotency.Config{LockTimeout: 50 * time.Millisecond})
+	server.block = make(chan struct{})
+	server.started = make(chan struct{})
+
+	first := make(chan *http.Response)
+	go func() {
+		resp, _ := server.do(t, "POST", "key-1", "user-1", "amount=100")
+		first <- resp
+	}()
+	<-server.started
+
+	// Retries still conflict after the LockTimeout while the handler is running
+	time.Sleep(200 * time.Millisecond)
+	resp, _ := server.do(t, "POST", "key-1", "user-1", "amount=100")
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	close(server.block)
+	require.Equal(t, http.StatusCreated, (<-first).StatusCode)
+	require.Equal(t, int32(1), server.calls.Load())
+}
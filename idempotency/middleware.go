@@ -0,0 +1,276 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/moov-io/base"
+	moovhttp "github.com/moov-io/base/http"
+	"github.com/moov-io/base/log"
+)
+
+const (
+	// HeaderName is the request header clients set to make retries safe.
+	HeaderName = "Idempotency-Key"
+
+	// ReplayedHeader is set on responses replayed from a previous request.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+// Config controls which requests the middleware handles.
+type Config struct {
+	// Methods which are made idempotent, defaults to POST.
+	Methods []string
+
+	// Required rejects requests without an Idempotency-Key header.
+	Required bool
+
+	// TTL is how long responses are replayed, defaults to 24h.
+	TTL time.Duration
+
+	// LockTimeout is how long an in flight request blocks retries before it's considered
+	// abandoned, defaults to 1m. The lock is extended while the handler is running.
+	LockTimeout time.Duration
+
+	// MaxBodyBytes limits the request bodies read for fingerprinting, defaults to 1MiB.
+	// Larger requests are rejected with 413 Request Entity Too Large.
+	MaxBodyBytes int64
+}
+
+func (cfg Config) withDefaults() Config {
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{http.MethodPost}
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.LockTimeout <= 0 {
+		cfg.LockTimeout = time.Minute
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = 1 << 20
+	}
+	return cfg
+}
+
+// Middleware returns a gorilla/mux middleware which replays the stored response for retried requests.
+// Requests are identified by their Idempotency-Key header and http.GetUserID, requests with a key but
+// no user ID are rejected with 400 Bad Request. A retry with a different method, path, query or body is
+// rejected with 422 Unprocessable Entity and a retry while the first request is still in flight is
+// rejected with 409 Conflict. Server errors aren't stored so they can be retried.
+func Middleware(logger log.Logger, store Store, cfg Config) mux.MiddlewareFunc {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	cfg = cfg.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(cfg.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idempotencyKey := r.Header.Get(HeaderName)
+			switch {
+			case idempotencyKey == "" && !cfg.Required:
+				next.ServeHTTP(w, r)
+				return
+			case idempotencyKey == "":
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("missing %s header", HeaderName))
+				return
+			case len(idempotencyKey) > maxKeyLength:
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s header is longer than %d characters", HeaderName, maxKeyLength))
+				return
+			}
+
+			// Keys are scoped to each user, so anonymous callers can't be kept apart
+			userID := moovhttp.GetUserID(r)
+			if userID == "" {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s requires an authenticated user", HeaderName))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit))
+					return
+				}
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("reading request body: %v", err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := Key{UserID: userID, Key: idempotencyKey}
+			logger := logger.With(log.Fields{
+				"idempotency_key": log.String(key.Key),
+				"requestID":       log.String(moovhttp.GetRequestID(r)),
+			})
+
+			now := time.Now()
+			rec := Record{
+				Key:         key,
+				Token:       base.ID(),
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now,
+				LockedUntil: now.Add(cfg.LockTimeout),
+				ExpiresAt:   now.Add(cfg.TTL),
+			}
+			existing, err := store.Reserve(r.Context(), rec)
+			if err != nil {
+				logger.Error().LogErrorf("reserving idempotency key: %w", err)
+				moovhttp.InternalError(w, err)
+				return
+			}
+
+			switch {
+			case existing == nil:
+				serve(logger, store, cfg, rec, next, w, r)
+			case existing.Fingerprint != rec.Fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s was used with a different request", HeaderName))
+			case existing.Response == nil:
+				writeError(w, http.StatusConflict, fmt.Sprintf("a request with this %s is in progress", HeaderName))
+			default:
+				replay(w, *existing.Response)
+			}
+		})
+	}
+}
+
+// serve runs the handler for a reserved request and stores its response.
+func serve(logger log.Logger, store Store, cfg Config, rec Record, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	recorder := &responseRecorder{ResponseWriter: w}
+
+	// Keep the lock while the handler runs so retries don't execute it a second time
+	done := make(chan struct{})
+	extended := make(chan struct{})
+	go func() {
+		defer close(extended)
+		extendLock(logger, store, cfg, rec, done)
+	}()
+	defer func() {
+		close(done)
+		<-extended
+	}()
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		// Free the key when the handler panics or fails so the client can retry
+		if err := store.Release(r.Context(), rec.Key, rec.Token); err != nil {
+			logger.Warn().LogErrorf("releasing idempotency key: %w", err)
+		}
+	}()
+
+	next.ServeHTTP(recorder, r)
+
+	response := recorder.response()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return
+	}
+	if err := store.Complete(r.Context(), rec.Key, rec.Token, response); err != nil {
+		logger.Error().LogErrorf("storing idempotent response: %w", err)
+		return
+	}
+	completed = true
+}
+
+// extendLock pushes back the reservation's LockedUntil at half the LockTimeout until done is closed.
+func extendLock(logger log.Logger, store Store, cfg Config, rec Record, done <-chan struct{}) {
+	ticker := time.NewTicker(cfg.LockTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := store.Extend(context.Background(), rec.Key, rec.Token, time.Now().Add(cfg.LockTimeout)); err != nil {
+				logger.Warn().LogErrorf("extending idempotency key lock: %w", err)
+			}
+		}
+	}
+}
+
+func replay(w http.ResponseWriter, response Response) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(response.StatusCode)
+	w.Write(response.Body)
+}
+
+// fingerprint hashes the parts of a request which must match for it to be a retry.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", r.Method, r.URL.Path, r.URL.Query().Encode())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": msg,
+	})
+}
+
+// responseRecorder passes the response through while keeping a copy to replay.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	statusCode int
+	header     http.Header
+	body       bytes.Buffer
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	if w.statusCode != 0 {
+		return
+	}
+	w.statusCode = code
+	w.header = w.ResponseWriter.Header().Clone()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) response() Response {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return Response{
+		StatusCode: w.statusCode,
+		Header:     w.header,
+		Body:       w.body.Bytes(),
+	}
+}
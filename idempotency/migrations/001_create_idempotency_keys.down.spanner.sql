@@ -0,0 +1,3 @@
+DROP INDEX idempotency_keys_expires_at;
+
+DROP TABLE idempotency_keys;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+    user_id VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    token VARCHAR(40) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    status_code INT,
+    headers TEXT,
+    body LONGBLOB,
+    created_at DATETIME(6) NOT NULL,
+    locked_until DATETIME(6) NOT NULL,
+    expires_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key),
+    INDEX idempotency_keys_expires_at (expires_at)
+);
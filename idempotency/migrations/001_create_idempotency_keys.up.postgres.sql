@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+    user_id TEXT NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    token TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status_code INT,
+    headers TEXT,
+    body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at ON idempotency_keys (expires_at);
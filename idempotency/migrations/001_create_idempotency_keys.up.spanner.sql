@@ -0,0 +1,14 @@
+CREATE TABLE idempotency_keys (
+    user_id STRING(255) NOT NULL,
+    idempotency_key STRING(255) NOT NULL,
+    token STRING(40) NOT NULL,
+    fingerprint STRING(64) NOT NULL,
+    status_code INT64,
+    headers STRING(MAX),
+    body BYTES(MAX),
+    created_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+) PRIMARY KEY (user_id, idempotency_key);
+
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,140 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Key identifies a request by the caller's user ID and the Idempotency-Key header they sent.
+type Key struct {
+	UserID string
+	Key    string
+}
+
+// Response is a completed response which is replayed for retries of the same request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Record is a request seen for a Key.
+type Record struct {
+	Key Key
+
+	// Token identifies the reservation, so a request which lost its reservation can't complete
+	// or release another request's.
+	Token string
+
+	// Fingerprint is a hash of the request, retries with a different fingerprint are rejected.
+	Fingerprint string
+
+	// Response is nil while the request is in flight.
+	Response *Response
+
+	CreatedAt time.Time
+
+	// LockedUntil is when an in flight request is considered abandoned and may be retried.
+	LockedUntil time.Time
+
+	// ExpiresAt is when the record is forgotten and the key may be reused.
+	ExpiresAt time.Time
+}
+
+// Store keeps Records for the idempotency middleware.
+type Store interface {
+	// Reserve saves rec as in flight and returns nil, or returns the existing record for rec.Key.
+	// Expired records and in flight records past their LockedUntil are replaced.
+	Reserve(ctx context.Context, rec Record) (*Record, error)
+
+	// Complete saves the response of a reserved request.
+	Complete(ctx context.Context, key Key, token string, response Response) error
+
+	// Release removes a reservation so the request can be retried.
+	Release(ctx context.Context, key Key, token string) error
+
+	// Extend moves the LockedUntil of an in flight reservation while its request is still running.
+	Extend(ctx context.Context, key Key, token string, lockedUntil time.Time) error
+}
+
+// MemoryStore keeps records in memory, which is suitable for tests and single instance applications.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[Key]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[Key]Record),
+	}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, rec Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, found := s.records[rec.Key]; found && !replaceable(existing, time.Now()) {
+		return &existing, nil
+	}
+	s.records[rec.Key] = rec
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key Key, token string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, found := s.records[key]; found && rec.Token == token {
+		rec.Response = &response
+		s.records[key] = rec
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key Key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, found := s.records[key]; found && rec.Token == token && rec.Response == nil {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Extend(_ context.Context, key Key, token string, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, found := s.records[key]; found && rec.Token == token && rec.Response == nil {
+		rec.LockedUntil = lockedUntil
+		s.records[key] = rec
+	}
+	return nil
+}
+
+// Purge removes expired records.
+func (s *MemoryStore) Purge(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	now := time.Now()
+	for key, rec := range s.records {
+		if rec.ExpiresAt.Before(now) {
+			delete(s.records, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func replaceable(rec Record, now time.Time) bool {
+	return rec.ExpiresAt.Before(now) || (rec.Response == nil && rec.LockedUntil.Before(now))
+}
@@ -0,0 +1,369 @@
+package log
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// OverflowPolicy decides what an AsyncWriter does with log lines once its queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits for room in the queue.
+	OverflowBlock = OverflowPolicy("block")
+
+	// OverflowDropNewest drops the line being logged.
+	OverflowDropNewest = OverflowPolicy("drop_newest")
+
+	// OverflowDropDebug drops debug lines (queued or new) to make room. Other lines wait for room
+	// when no debug lines are queued.
+	OverflowDropDebug = OverflowPolicy("drop_debug")
+)
+
+// AsyncConfig configures an AsyncWriter.
+type AsyncConfig struct {
+	QueueSize int // defaults to 1024
+	Overflow  OverflowPolicy
+
+	// Name labels the log_async_queue_depth and log_async_dropped metrics. Writers sharing a Name
+	// within Registerer share the metrics. Metrics are only registered when Name or Registerer is set.
+	Name string
+
+	// Registerer receives the metrics, defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// ErrAsyncWriterClosed is returned when logging to a closed AsyncWriter.
+var ErrAsyncWriterClosed = errors.New("async log writer is closed")
+
+// AsyncWriter queues log lines and writes them to another go-kit log.Logger in the background,
+// so slow log output doesn't add latency to callers.
+type AsyncWriter struct {
+	next log.Logger
+	cfg  AsyncConfig
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    [][]interface{}
+	writing  bool
+	closed   bool
+	drained  chan struct{} // closed whenever the queue is empty and nothing is being written
+
+	queueDepth prometheus.Gauge
+	depth      int // last queue length added to queueDepth
+	dropCount  *prometheus.CounterVec
+	registerer prometheus.Registerer
+	registered []prometheus.Collector
+
+	done chan struct{}
+}
+
+// NewAsyncWriter starts writing queued lines to next. Call Close to flush and stop the writer.
+func NewAsyncWriter(next log.Logger, cfg AsyncConfig) *AsyncWriter {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = OverflowBlock
+	}
+
+	w := &AsyncWriter{
+		next:    next,
+		cfg:     cfg,
+		queue:   make([][]interface{}, 0, cfg.QueueSize),
+		drained: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	close(w.drained)
+	w.notEmpty = sync.NewCond(&w.mu)
+	w.notFull = sync.NewCond(&w.mu)
+
+	switch {
+	case cfg.Registerer != nil:
+		w.registerer = cfg.Registerer
+	case cfg.Name != "":
+		w.registerer = prometheus.DefaultRegisterer
+	}
+	labels := prometheus.Labels{"name": cmp.Or(cfg.Name, "default")}
+	w.queueDepth = registerAsyncMetric(w, prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "log_async_queue_depth",
+		Help:        "How many log lines are waiting to be written by an async log writer.",
+		ConstLabels: labels,
+	}))
+	w.dropCount = registerAsyncMetric(w, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "log_async_dropped",
+		Help:        "How many log lines an async log writer dropped because its queue was full.",
+		ConstLabels: labels,
+	}, []string{"level"}))
+
+	go w.run()
+
+	return w
+}
+
+// WithAsync writes log lines through an AsyncWriter. Use Flush to write queued lines, or Close
+// to also stop the writer, before shutdown.
+func WithAsync(cfg AsyncConfig) Option {
+	return func(o *options) {
+		o.async = &cfg
+	}
+}
+
+// Log queues keyvals to be written.
+func (w *AsyncWriter) Log(keyvals ...interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	level := levelOf(keyvals)
+	for len(w.queue) >= w.cfg.QueueSize && !w.closed {
+		switch w.cfg.Overflow {
+		case OverflowDropNewest:
+			w.dropped(level)
+			return nil
+
+		case OverflowDropDebug:
+			if level == Debug {
+				w.dropped(level)
+				return nil
+			}
+			if w.dropQueuedDebug() {
+				continue
+			}
+			w.notFull.Wait()
+
+		default:
+			w.notFull.Wait()
+		}
+	}
+	if w.closed {
+		return ErrAsyncWriterClosed
+	}
+
+	if len(w.queue) == 0 && !w.writing {
+		w.drained = make(chan struct{})
+	}
+	w.queue = append(w.queue, keyvals)
+	w.updateQueueDepth()
+	w.notEmpty.Signal()
+
+	return nil
+}
+
+// Len returns how many lines are queued.
+func (w *AsyncWriter) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.queue)
+}
+
+// Flush waits until every queued line has been written or ctx is done.
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	drained := w.drained
+	w.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flushing async log writer: %w", ctx.Err())
+	}
+}
+
+// Close flushes queued lines and stops the writer. Lines logged after Close return ErrAsyncWriterClosed.
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	err := w.Flush(ctx)
+
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		w.notEmpty.Broadcast()
+		w.notFull.Broadcast()
+
+		// Let another writer use the same name
+		for _, c := range w.registered {
+			unregisterAsyncMetric(w.registerer, c)
+		}
+		w.registered = nil
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		if err == nil {
+			err = fmt.Errorf("closing async log writer: %w", ctx.Err())
+		}
+	}
+	return err
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.notEmpty.Wait()
+		}
+		if len(w.queue) == 0 && w.closed {
+			w.mu.Unlock()
+			return
+		}
+
+		keyvals := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.writing = true
+		w.updateQueueDepth()
+		w.notFull.Signal()
+		w.mu.Unlock()
+
+		_ = w.next.Log(keyvals...)
+
+		w.mu.Lock()
+		w.writing = false
+		if len(w.queue) == 0 {
+			close(w.drained)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// dropQueuedDebug removes the oldest queued debug line. Callers must hold w.mu.
+func (w *AsyncWriter) dropQueuedDebug() bool {
+	for i, keyvals := range w.queue {
+		if levelOf(keyvals) == Debug {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			w.dropped(Debug)
+			return true
+		}
+	}
+	return false
+}
+
+// updateQueueDepth adds the change in queue length to queueDepth, which writers sharing a Name
+// add to together. Callers must hold w.mu.
+func (w *AsyncWriter) updateQueueDepth() {
+	w.queueDepth.Add(float64(len(w.queue) - w.depth))
+	w.depth = len(w.queue)
+}
+
+func (w *AsyncWriter) dropped(level Level) {
+	w.dropCount.WithLabelValues(string(level)).Inc()
+}
+
+// Flusher is implemented by Loggers and writers which buffer log lines, such as AsyncWriter.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Flush writes the lines buffered by l, such as a Logger created with WithAsync. Loggers which
+// don't buffer lines return immediately.
+func Flush(ctx context.Context, l Logger) error {
+	if f, ok := l.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	if impl, ok := l.(*logger); ok {
+		if f, ok := impl.writer.(Flusher); ok {
+			return f.Flush(ctx)
+		}
+	}
+	return nil
+}
+
+// Close flushes l and stops its background work, such as the goroutines started by WithAsync
+// and WithSampling, then closes its writer if it's an io.Closer (for example the files of
+// NewSinkLogger). Every Logger derived from l with Set, With or the level methods is closed too.
+func Close(ctx context.Context, l Logger) error {
+	if c, ok := l.(interface{ Close(context.Context) error }); ok {
+		return c.Close(ctx)
+	}
+
+	impl, ok := l.(*logger)
+	if !ok {
+		return nil
+	}
+	if impl.opts != nil && impl.opts.sampler != nil {
+		impl.opts.sampler.close()
+	}
+	return closeWriter(ctx, impl.writer)
+}
+
+func closeWriter(ctx context.Context, writer log.Logger) error {
+	switch w := writer.(type) {
+	case *AsyncWriter:
+		return errors.Join(w.Close(ctx), closeWriter(ctx, w.next))
+	case interface{ Close(context.Context) error }:
+		return w.Close(ctx)
+	case io.Closer:
+		return w.Close()
+	}
+	return nil
+}
+
+func levelOf(keyvals []interface{}) Level {
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "level" {
+			if s, ok := keyvals[i+1].(string); ok {
+				return Level(s)
+			}
+		}
+	}
+	return ""
+}
+
+var (
+	asyncMetricsMu   sync.Mutex
+	asyncMetricsRefs = make(map[prometheus.Collector]int)
+)
+
+// registerAsyncMetric registers c with w.registerer. When a writer with the same Name already
+// registered the metric its collector is returned instead, so both writers report to it.
+// Collectors which can't be registered are returned as-is and only miss out on being exported.
+func registerAsyncMetric[T prometheus.Collector](w *AsyncWriter, c T) T {
+	if w.registerer == nil {
+		return c
+	}
+
+	asyncMetricsMu.Lock()
+	defer asyncMetricsMu.Unlock()
+
+	if err := w.registerer.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if !errors.As(err, &are) {
+			return c
+		}
+		existing, ok := are.ExistingCollector.(T)
+		if !ok {
+			return c
+		}
+		c = existing
+	}
+	asyncMetricsRefs[c]++
+	w.registered = append(w.registered, c)
+
+	return c
+}
+
+// unregisterAsyncMetric unregisters c once no other writer reports to it.
+func unregisterAsyncMetric(registerer prometheus.Registerer, c prometheus.Collector) {
+	asyncMetricsMu.Lock()
+	defer asyncMetricsMu.Unlock()
+
+	asyncMetricsRefs[c]--
+	if asyncMetricsRefs[c] > 0 {
+		return
+	}
+	delete(asyncMetricsRefs, c)
+	registerer.Unregister(c)
+}
@@ -0,0 +1,245 @@
+package log_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+// gatedWriter records lines once its gate is opened
+type gatedWriter struct {
+	gate chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func (g *gatedWriter) Log(keyvals ...interface{}) error {
+	<-g.gate
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var msg, level string
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		case "level":
+			level = fmt.Sprint(keyvals[i+1])
+		}
+	}
+	g.lines = append(g.lines, level+":"+msg)
+	return nil
+}
+
+func (g *gatedWriter) Lines() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.lines...)
+}
+
+func Test_AsyncWriter(t *testing.T) {
+	buffer := &strings.Builder{}
+	var mu sync.Mutex
+	next := log.LoggerFunc(func(keyvals ...interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return log.NewLogfmtLogger(buffer).Log(keyvals...)
+	})
+
+	logger := lib.NewLogger(next, lib.WithAsync(lib.AsyncConfig{Name: "test"}))
+	for i := 0; i < 100; i++ {
+		logger.Info().Logf("line %d", i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, lib.Flush(ctx, logger))
+
+	mu.Lock()
+	require.Equal(t, 100, strings.Count(buffer.String(), "level=info"))
+	require.Contains(t, buffer.String(), `msg="line 99"`)
+	mu.Unlock()
+
+	// Close stops the background writer, derived loggers share it
+	logger.Info().Log("last")
+	require.NoError(t, lib.Close(ctx, logger.Set("k", lib.String("v"))))
+	logger.Info().Log("after close")
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, buffer.String(), "msg=last")
+	require.NotContains(t, buffer.String(), "after close")
+}
+
+func Test_AsyncWriter_Metrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	next := newGatedWriter()
+	w := lib.NewAsyncWriter(next, lib.AsyncConfig{
+		Name:       "metrics",
+		QueueSize:  1,
+		Overflow:   lib.OverflowDropNewest,
+		Registerer: registry,
+	})
+	logger := lib.NewLogger(w)
+
+	logger.Info().Log("0")
+	require.Eventually(t, func() bool { return queueEmpty(w) }, time.Second, time.Millisecond)
+	logger.Info().Log("1")
+	logger.Info().Log("2") // dropped
+
+	expected := `
+# HELP log_async_dropped How many log lines an async log writer dropped because its queue was full.
+# TYPE log_async_dropped counter
+log_async_dropped{level="info",name="metrics"} 1
+# HELP log_async_queue_depth How many log lines are waiting to be written by an async log writer.
+# TYPE log_async_queue_depth gauge
+log_async_queue_depth{name="metrics"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	// Writers with the same name share the metrics
+	otherNext := newGatedWriter()
+	other := lib.NewAsyncWriter(otherNext, lib.AsyncConfig{
+		Name:       "metrics",
+		QueueSize:  1,
+		Overflow:   lib.OverflowDropNewest,
+		Registerer: registry,
+	})
+	otherLogger := lib.NewLogger(other)
+	otherLogger.Info().Log("0")
+	require.Eventually(t, func() bool { return queueEmpty(other) }, time.Second, time.Millisecond)
+	otherLogger.Info().Log("1")
+	otherLogger.Info().Log("2") // dropped
+
+	expected = strings.ReplaceAll(expected, "} 1", "} 2")
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	close(next.gate)
+	require.NoError(t, w.Close(context.Background()))
+
+	// Metrics stay registered while another writer uses them
+	expected = strings.ReplaceAll(expected, `{name="metrics"} 2`, `{name="metrics"} 1`)
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	// The last writer to close unregisters them
+	close(otherNext.gate)
+	require.NoError(t, other.Close(context.Background()))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	require.Empty(t, families)
+}
+
+func Test_AsyncWriter_DropNewest(t *testing.T) {
+	next := newGatedWriter()
+	w := lib.NewAsyncWriter(next, lib.AsyncConfig{
+		Name:      "drop-newest",
+		QueueSize: 2,
+		Overflow:  lib.OverflowDropNewest,
+	})
+	logger := lib.NewLogger(w)
+
+	// The first line is picked up by the background writer (blocked on the gate)
+	logger.Info().Log("0")
+	require.Eventually(t, func() bool { return queueEmpty(w) }, time.Second, time.Millisecond)
+
+	for i := 1; i <= 5; i++ {
+		logger.Info().Logf("%d", i)
+	}
+	close(next.gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, w.Close(ctx))
+
+	require.Equal(t, []string{"info:0", "info:1", "info:2"}, next.Lines())
+	require.ErrorIs(t, w.Log("msg", "late"), lib.ErrAsyncWriterClosed)
+}
+
+func Test_AsyncWriter_DropDebug(t *testing.T) {
+	next := newGatedWriter()
+	w := lib.NewAsyncWriter(next, lib.AsyncConfig{
+		Name:      "drop-debug",
+		QueueSize: 2,
+		Overflow:  lib.OverflowDropDebug,
+	})
+	logger := lib.NewLogger(w)
+
+	logger.Info().Log("0")
+	require.Eventually(t, func() bool { return queueEmpty(w) }, time.Second, time.Millisecond)
+
+	logger.Debug().Log("1")
+	logger.Info().Log("2")
+	logger.Warn().Log("3")  // evicts the queued debug line
+	logger.Debug().Log("4") // dropped
+
+	done := make(chan struct{})
+	go func() {
+		logger.Error().Log("5") // waits for room
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected error line to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(next.gate)
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, w.Close(ctx))
+
+	require.Equal(t, []string{"info:0", "info:2", "warn:3", "error:5"}, next.Lines())
+}
+
+func Test_AsyncWriter_FlushTimeout(t *testing.T) {
+	next := newGatedWriter()
+	w := lib.NewAsyncWriter(next, lib.AsyncConfig{Name: "timeout"})
+	require.NoError(t, w.Log("msg", "stuck"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, w.Flush(ctx), context.DeadlineExceeded)
+
+	close(next.gate)
+	require.NoError(t, w.Close(context.Background()))
+}
+
+func Test_Close_Sampling(t *testing.T) {
+	buffer, logger := lib.NewBufferLogger(lib.WithSampling(lib.SamplingConfig{
+		Interval: time.Hour,
+		First:    1,
+	}))
+	for i := 0; i < 3; i++ {
+		logger.Info().Log("repeated")
+	}
+
+	// Remaining drops are reported when the sampler stops
+	require.NoError(t, lib.Close(context.Background(), logger))
+	require.Contains(t, buffer.String(), `msg="dropped sampled log lines" dropped=2`)
+	require.NoError(t, lib.Close(context.Background(), logger))
+}
+
+// queueEmpty reports if the background writer has taken every queued line
+func queueEmpty(w *lib.AsyncWriter) bool {
+	return w.Len() == 0
+}
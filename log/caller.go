@@ -0,0 +1,165 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/moov-io/base"
+)
+
+const logPackage = "github.com/moov-io/base/log"
+
+// WithCaller adds a "caller" field with the file:line which called Log, Logf or LogError.
+// skip is how many additional frames to skip, for helpers which wrap a Logger.
+func WithCaller(skip int) Option {
+	return func(o *options) {
+		o.caller = true
+		o.callerSkip = skip
+	}
+}
+
+// caller returns the dir/file.go:line of the first frame outside of this package, after skip frames.
+func caller(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if pkg := funcPackage(frame.Function); pkg != logPackage && pkg != "log/slog" {
+			if skip == 0 {
+				return fmt.Sprintf("%s:%d", shortFile(frame.File), frame.Line)
+			}
+			skip--
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// Stack returns a Context with a "stack" field holding up to depth application frames.
+// Frames from the Go runtime, the standard library and this package are left out.
+func Stack(depth int) Context {
+	return stack(depth)
+}
+
+type stack int
+
+func (s stack) Context() map[string]Valuer {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var out []Valuer
+	for len(out) < int(s) {
+		frame, more := frames.Next()
+		if applicationFrame(frame) {
+			out = append(out, String(fmt.Sprintf("%s %s:%d", frame.Function, shortFile(frame.File), frame.Line)))
+		}
+		if !more {
+			break
+		}
+	}
+
+	return map[string]Valuer{
+		"stack": Array(out...),
+	}
+}
+
+func applicationFrame(frame runtime.Frame) bool {
+	pkg := funcPackage(frame.Function)
+	switch {
+	case pkg == "main":
+		return true
+	case pkg == "" || pkg == logPackage:
+		return false
+	}
+
+	// Standard library packages don't have a domain in their first path element
+	first, _, _ := strings.Cut(pkg, "/")
+	return strings.Contains(first, ".")
+}
+
+// funcPackage returns the import path from a function name such as "github.com/moov-io/base/log.(*logger).Log".
+func funcPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
+
+// shortFile trims a path to its last directory and file name.
+func shortFile(file string) string {
+	idx := strings.LastIndex(file, "/")
+	if idx < 0 {
+		return file
+	}
+	if prev := strings.LastIndex(file[:idx], "/"); prev >= 0 {
+		return file[prev+1:]
+	}
+	return file
+}
+
+// WithErrorCauses writes the messages of the errors wrapped by those given to LogError and LogErrorf
+// under "causes".
+func WithErrorCauses() Option {
+	return func(o *options) {
+		o.errorCauses = true
+	}
+}
+
+// errorFields describes err for LogError. Errors in a base.ErrorList are written under "errors"
+// and the line and record of a base.ParseError become fields. With causes the wrapped errors are
+// written under "causes".
+func errorFields(err error, causes bool) Fields {
+	fields := parseErrorFields(err)
+
+	var list base.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		members := make([]Valuer, 0, len(list))
+		for _, member := range list {
+			if member == nil {
+				continue
+			}
+			memberFields := parseErrorFields(member)
+			memberFields["message"] = String(member.Error())
+			members = append(members, Object(memberFields))
+		}
+		fields["errors"] = Array(members...)
+	}
+
+	if wrapped := unwrapAll(err); causes && len(wrapped) > 0 {
+		causes := make([]Valuer, len(wrapped))
+		for i := range wrapped {
+			causes[i] = String(wrapped[i].Error())
+		}
+		fields["causes"] = Array(causes...)
+	}
+
+	return fields
+}
+
+func parseErrorFields(err error) Fields {
+	fields := Fields{}
+
+	var pe base.ParseError
+	var ptr *base.ParseError
+	switch {
+	case errors.As(err, &pe):
+	case errors.As(err, &ptr) && ptr != nil:
+		pe = *ptr
+	default:
+		return fields
+	}
+
+	fields["line"] = Int(pe.Line)
+	if pe.Record != "" {
+		fields["record"] = String(pe.Record)
+	}
+	return fields
+}
@@ -0,0 +1,95 @@
+package log_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base"
+	lib "github.com/moov-io/base/log"
+)
+
+func TestWithCaller(t *testing.T) {
+	buffer, logger := lib.NewBufferLogger(lib.WithCaller(0))
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info().Log("direct")
+	require.Contains(t, buffer.String(), fmt.Sprintf("caller=log/caller_test.go:%d ", line+1))
+
+	buffer, logger = lib.NewBufferLogger(lib.WithCaller(1))
+
+	_, _, line, _ = runtime.Caller(0)
+	logHelper(logger)
+	require.Contains(t, buffer.String(), fmt.Sprintf("caller=log/caller_test.go:%d ", line+1))
+}
+
+func logHelper(logger lib.Logger) {
+	logger.Info().Log("from helper")
+}
+
+func TestStack(t *testing.T) {
+	captured, logger := lib.NewCapturedLogger(t)
+
+	logger.With(lib.Stack(2)).Log("with stack")
+
+	entries := captured.Entries()
+	require.Len(t, entries, 1)
+
+	stack, ok := entries[0].Fields["stack"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, stack, 1) // testing.tRunner and runtime frames are skipped
+	require.Contains(t, stack[0], "log_test.TestStack log/caller_test.go:")
+}
+
+func TestLogError_Fields(t *testing.T) {
+	captured, logger := lib.NewCapturedLogger(t, lib.WithErrorCauses())
+
+	var list base.ErrorList
+	list.Add(base.ParseError{Line: 2, Record: "BatchHeader", Err: errors.New("invalid")})
+	list.Add(errors.New("missing trailer"))
+
+	logger.LogError(fmt.Errorf("reading file: %w", list))
+
+	entries := captured.Entries()
+	require.Len(t, entries, 1)
+
+	fields := entries[0].Fields
+	require.Equal(t, true, fields["errored"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"line": 2, "record": "BatchHeader", "message": "line:2 record:BatchHeader *errors.errorString invalid"},
+		map[string]interface{}{"message": "missing trailer"},
+	}, fields["errors"])
+	require.Equal(t, []interface{}{list.Error()}, fields["causes"])
+
+	captured.Reset()
+	logger.LogError(fmt.Errorf("parsing: %w", &base.ParseError{Line: 7, Err: errors.New("bad")}))
+
+	fields = captured.Entries()[0].Fields
+	require.Equal(t, 7, fields["line"])
+	require.NotContains(t, fields, "record")
+	require.Len(t, fields["causes"], 2)
+
+	captured.Reset()
+	logger.LogError(errors.New("plain"))
+	require.Equal(t, map[string]interface{}{"errored": true}, captured.Entries()[0].Fields)
+}
+
+func TestLogError_WithoutCauses(t *testing.T) {
+	captured, logger := lib.NewCapturedLogger(t)
+
+	logger.LogErrorf("reading file: %w", errors.New("missing trailer"))
+	require.Equal(t, map[string]interface{}{"errored": true}, captured.Entries()[0].Fields)
+}
+
+func TestLogError_FieldsLogfmt(t *testing.T) {
+	buffer, logger := lib.NewBufferLogger()
+
+	logger.LogError(base.ErrorList{errors.New("a"), errors.New("b")})
+
+	line := strings.TrimSpace(buffer.String())
+	require.Contains(t, line, "errors.0.message=a errors.1.message=b")
+}
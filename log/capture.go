@@ -0,0 +1,174 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Entry is one log line recorded by a CapturedLogger. Fields hold the values written by Valuers,
+// e.g. String gives a string, Int an int and Object a map[string]interface{}.
+type Entry struct {
+	Level   Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("level=%s msg=%q fields=%v", e.Level, e.Message, e.Fields)
+}
+
+// NewCapturedLogger returns a Logger which records every line as an Entry. The recorded entries are
+// written to the test output if t has failed once it completes.
+func NewCapturedLogger(t testing.TB, opts ...Option) (*CapturedLogger, Logger) {
+	captured := &CapturedLogger{}
+
+	t.Cleanup(func() {
+		if t.Failed() {
+			captured.dump(t)
+		}
+	})
+
+	opts = append([]Option{WithStructuredValues()}, opts...)
+	return captured, NewLogger(captured, opts...)
+}
+
+// CapturedLogger is a go-kit log.Logger which records log lines for tests to inspect.
+type CapturedLogger struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+func (c *CapturedLogger) Log(keyvals ...interface{}) error {
+	entry := Entry{
+		Fields: make(map[string]interface{}, len(keyvals)/2),
+	}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch key {
+		case "ts":
+			continue
+		case "msg":
+			entry.Message = fmt.Sprint(keyvals[i+1])
+		case "level":
+			entry.Level = Level(fmt.Sprint(keyvals[i+1]))
+		default:
+			entry.Fields[key] = keyvals[i+1]
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = append(c.entries, entry)
+	return nil
+}
+
+// Entries returns the recorded log lines in the order they were logged.
+func (c *CapturedLogger) Entries() []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make([]Entry, len(c.entries))
+	copy(out, c.entries)
+	return out
+}
+
+// Reset removes every recorded log line.
+func (c *CapturedLogger) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// Find returns the entries logged at level with msg which contain each of fields.
+// An empty level or msg matches every entry.
+func (c *CapturedLogger) Find(level Level, msg string, fields Fields) []Entry {
+	var out []Entry
+	for _, entry := range c.Entries() {
+		if entry.matches(level, msg, fields) {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// AssertLogged fails t unless an entry was logged at level with msg containing each of fields.
+// An empty level or msg matches every entry.
+func (c *CapturedLogger) AssertLogged(t testing.TB, level Level, msg string, fields Fields) bool {
+	t.Helper()
+
+	if len(c.Find(level, msg, fields)) > 0 {
+		return true
+	}
+
+	want := Entry{Level: level, Message: msg, Fields: make(map[string]interface{}, len(fields))}
+	for k, v := range fields {
+		want.Fields[k] = valueOf(v)
+	}
+	t.Errorf("no log entry matching %v in:\n%s", want, c.String())
+	return false
+}
+
+// AssertNoErrors fails t if any entry was logged at error level or above.
+func (c *CapturedLogger) AssertNoErrors(t testing.TB) bool {
+	t.Helper()
+
+	var errs []string
+	for _, entry := range c.Entries() {
+		if entry.Level != "" && entry.Level.Enabled(Error) {
+			errs = append(errs, entry.String())
+		}
+	}
+	if len(errs) > 0 {
+		t.Errorf("unexpected error log entries:\n%s", strings.Join(errs, "\n"))
+		return false
+	}
+	return true
+}
+
+// String returns each recorded entry on its own line.
+func (c *CapturedLogger) String() string {
+	entries := c.Entries()
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *CapturedLogger) dump(t testing.TB) {
+	t.Helper()
+
+	entries := c.Entries()
+	if len(entries) == 0 {
+		return
+	}
+	t.Logf("captured %d log entries:\n%s", len(entries), c.String())
+}
+
+func (e Entry) matches(level Level, msg string, fields Fields) bool {
+	if level != "" && e.Level != level {
+		return false
+	}
+	if msg != "" && e.Message != msg {
+		return false
+	}
+	for k, v := range fields {
+		got, ok := e.Fields[k]
+		if !ok || !reflect.DeepEqual(got, valueOf(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func valueOf(v Valuer) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.getValue()
+}
@@ -0,0 +1,67 @@
+package log_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+// recordingT records failures instead of failing the test
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCapturedLogger(t *testing.T) {
+	captured, logger := lib.NewCapturedLogger(t)
+
+	logger.Set("user", lib.Object(lib.Fields{
+		"id": lib.String("u1"),
+	})).Set("attempts", lib.Int(3)).Log("signed in")
+	logger.Warn().Set("ms", lib.Int64(250)).Log("slow")
+
+	entries := captured.Entries()
+	require.Len(t, entries, 2)
+
+	require.Equal(t, lib.Info, entries[0].Level)
+	require.Equal(t, "signed in", entries[0].Message)
+	require.Equal(t, 3, entries[0].Fields["attempts"])
+	require.Equal(t, map[string]interface{}{"id": "u1"}, entries[0].Fields["user"])
+
+	require.Len(t, captured.Find(lib.Warn, "", nil), 1)
+	require.Len(t, captured.Find("", "", lib.Fields{"attempts": lib.Int(3)}), 1)
+	require.Empty(t, captured.Find("", "", lib.Fields{"attempts": lib.Int64(3)}))
+
+	require.True(t, captured.AssertLogged(t, lib.Info, "signed in", lib.Fields{
+		"attempts": lib.Int(3),
+		"user":     lib.Object(lib.Fields{"id": lib.String("u1")}),
+	}))
+	require.True(t, captured.AssertNoErrors(t))
+
+	captured.Reset()
+	require.Empty(t, captured.Entries())
+}
+
+func TestCapturedLogger_Failures(t *testing.T) {
+	captured, logger := lib.NewCapturedLogger(t)
+	rec := &recordingT{TB: t}
+
+	logger.Error().LogErrorf("connection refused")
+
+	require.False(t, captured.AssertLogged(rec, lib.Info, "connected", nil))
+	require.False(t, captured.AssertNoErrors(rec))
+
+	require.Len(t, rec.errors, 2)
+	require.Contains(t, rec.errors[0], `no log entry matching level=info msg="connected"`)
+	require.Contains(t, rec.errors[0], `level=error msg="connection refused" fields=map[errored:true]`)
+	require.Contains(t, rec.errors[1], "unexpected error log entries")
+}
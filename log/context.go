@@ -0,0 +1,109 @@
+package log
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+var (
+	registeredMu      sync.RWMutex
+	registeredDefault Logger
+
+	// stderrLogger follows MOOV_LOG_FORMAT, MOOV_LOG_LEVEL and MOOV_LOG_REDACTION but ignores MOOV_LOG_OUTPUT, so files
+	// opened by the application's logger aren't opened (and rotated) a second time.
+	stderrLogger = sync.OnceValue(func() Logger {
+		switch strings.ToLower(strings.TrimSpace(cmp.Or(os.Getenv("MOOV_LOG_FORMAT"), os.Getenv("LOG_FORMAT")))) {
+		case "json":
+			return NewJSONLogger(levelFromEnvironment(), redactionFromEnvironment())
+		case "nop", "noop":
+			return NewNopLogger()
+		default:
+			return NewLogFmtLogger(levelFromEnvironment(), redactionFromEnvironment())
+		}
+	})
+)
+
+// SetDefault registers the Logger returned by FromContext for contexts without one, which is
+// usually the application's root logger. Without it a logger writing to os.Stderr is used.
+func SetDefault(logger Logger) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	registeredDefault = logger
+}
+
+func defaultLogger() Logger {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+
+	if registeredDefault != nil {
+		return registeredDefault
+	}
+	return stderrLogger()
+}
+
+// WithContext returns a copy of ctx carrying logger.
+func WithContext(ctx context.Context, logger Logger) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the Logger stored with WithContext, or the Logger from SetDefault when ctx has none.
+// The trace_id and span_id of the active span in ctx are added to the returned Logger.
+func FromContext(ctx context.Context) Logger {
+	if ctx == nil {
+		return defaultLogger()
+	}
+
+	l, ok := ctx.Value(contextKey{}).(Logger)
+	if !ok || l == nil {
+		l = defaultLogger()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return l
+	}
+
+	out := l.With(TraceContext(ctx))
+	if impl, ok := out.(*logger); ok {
+		impl.span = span
+	}
+	return out
+}
+
+// TraceContext returns the trace_id and span_id of the active span in ctx, if any.
+func TraceContext(ctx context.Context) Context {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return Fields{}
+	}
+	return Fields{
+		"trace_id": String(sc.TraceID().String()),
+		"span_id":  String(sc.SpanID().String()),
+	}
+}
+
+// WithSpanErrors records errors logged with LogError and LogErrorf on the active span of
+// loggers returned by FromContext, the same as telemetry.RecordError does.
+func WithSpanErrors() Option {
+	return func(o *options) {
+		o.spanErrors = true
+	}
+}
+
+func (l *logger) recordSpanError(err error) {
+	if l.span == nil || l.opts == nil || !l.opts.spanErrors {
+		return
+	}
+	l.span.RecordError(err, trace.WithStackTrace(true))
+}
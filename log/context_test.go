@@ -0,0 +1,77 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	lib "github.com/moov-io/base/log"
+)
+
+func Test_FromContext(t *testing.T) {
+	buffer, log := lib.NewBufferLogger()
+
+	ctx := lib.WithContext(context.Background(), log.Set("request_id", lib.String("abc")))
+	lib.FromContext(ctx).Info().Log("without span")
+
+	output := buffer.String()
+	require.Contains(t, output, "request_id=abc")
+	require.NotContains(t, output, "trace_id")
+
+	// Missing loggers fall back to a default
+	require.NotNil(t, lib.FromContext(context.Background()))
+	require.NotNil(t, lib.FromContext(nil)) //nolint:staticcheck
+}
+
+func Test_FromContext_SetDefault(t *testing.T) {
+	buffer, log := lib.NewBufferLogger()
+	lib.SetDefault(log.Set("app", lib.String("payments")))
+	t.Cleanup(func() { lib.SetDefault(nil) })
+
+	lib.FromContext(context.Background()).Info().Log("registered")
+	require.Contains(t, buffer.String(), "app=payments")
+}
+
+func Test_FromContext_TraceCorrelation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	buffer, log := lib.NewBufferLogger(lib.WithSpanErrors())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "op")
+	ctx = lib.WithContext(ctx, log)
+
+	logger := lib.FromContext(ctx)
+	logger.Info().Log("with span")
+
+	output := buffer.String()
+	require.Contains(t, output, "trace_id="+span.SpanContext().TraceID().String())
+	require.Contains(t, output, "span_id="+span.SpanContext().SpanID().String())
+
+	err := logger.Set("extra", lib.String("value")).LogErrorf("failed: %w", errors.New("boom")).Err()
+	require.Error(t, err)
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 1)
+	require.Equal(t, "exception", events[0].Name)
+}
+
+func Test_FromContext_SpanErrorsDisabled(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, log := lib.NewBufferLogger()
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "op")
+	lib.FromContext(lib.WithContext(ctx, log)).LogError(errors.New("boom"))
+	span.End()
+
+	require.Empty(t, recorder.Ended()[0].Events())
+}
@@ -12,20 +12,40 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func NewDefaultLogger() Logger {
-	format := cmp.Or(os.Getenv("MOOV_LOG_FORMAT"), os.Getenv("LOG_FORMAT"))
+// NewDefaultLogger returns a Logger using the format from MOOV_LOG_FORMAT (or LOG_FORMAT) which
+// drops lines below the level from MOOV_LOG_LEVEL (or LOG_LEVEL). Fields named by the Keys of
+// DefaultRedaction are redacted unless MOOV_LOG_REDACTION (or LOG_REDACTION) is false, pass
+// WithRedaction to redact more.
+//
+// Lines are written to os.Stderr unless MOOV_LOG_OUTPUT (or LOG_OUTPUT) lists other sinks, see ParseSinks.
+func NewDefaultLogger(opts ...Option) Logger {
+	format := strings.ToLower(strings.TrimSpace(cmp.Or(os.Getenv("MOOV_LOG_FORMAT"), os.Getenv("LOG_FORMAT"))))
+
+	opts = append([]Option{levelFromEnvironment(), redactionFromEnvironment()}, opts...)
+
+	if output := cmp.Or(os.Getenv("MOOV_LOG_OUTPUT"), os.Getenv("LOG_OUTPUT")); output != "" && format != "nop" && format != "noop" {
+		sinks, err := ParseSinks(output, format)
+		if err == nil {
+			return NewSinkLogger(sinks, opts...)
+		}
+
+		logger := NewLogFmtLogger(opts...)
+		logger.Error().LogErrorf("invalid MOOV_LOG_OUTPUT, writing to stderr: %v", err)
+		return logger
+	}
 
-	switch strings.ToLower(strings.TrimSpace(format)) {
+	switch format {
 	case "json":
-		return NewJSONLogger()
+		return NewJSONLogger(opts...)
 	case "nop", "noop":
 		return NewNopLogger()
 	case "logfmt":
-		return NewLogFmtLogger()
+		return NewLogFmtLogger(opts...)
 	default:
-		return NewLogFmtLogger()
+		return NewLogFmtLogger(opts...)
 	}
 }
 
@@ -33,12 +53,13 @@ func NewNopLogger() Logger {
 	return NewLogger(log.NewNopLogger())
 }
 
-func NewLogFmtLogger() Logger {
-	return NewLogger(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)))
+func NewLogFmtLogger(opts ...Option) Logger {
+	return NewLogger(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)), opts...)
 }
 
-func NewJSONLogger() Logger {
-	return NewLogger(log.NewJSONLogger(log.NewSyncWriter(os.Stderr)))
+func NewJSONLogger(opts ...Option) Logger {
+	opts = append([]Option{WithStructuredValues()}, opts...)
+	return NewLogger(log.NewJSONLogger(log.NewSyncWriter(os.Stderr)), opts...)
 }
 
 func NewTestLogger() Logger {
@@ -48,12 +69,12 @@ func NewTestLogger() Logger {
 	return NewNopLogger()
 }
 
-func NewBufferLogger() (*BufferedLogger, Logger) {
+func NewBufferLogger(opts ...Option) (*BufferedLogger, Logger) {
 	buffer := &BufferedLogger{
 		buf: &strings.Builder{},
 	}
 	writer := log.NewLogfmtLogger(log.NewSyncWriter(buffer))
-	log := NewLogger(writer)
+	log := NewLogger(writer, opts...)
 	return buffer, log
 }
 
@@ -83,10 +104,16 @@ func (bl *BufferedLogger) String() string {
 	return bl.buf.String()
 }
 
-func NewLogger(writer log.Logger) Logger {
+func NewLogger(writer log.Logger, opts ...Option) Logger {
+	o := newOptions(opts)
+	if o.async != nil {
+		writer = NewAsyncWriter(writer, *o.async)
+	}
+
 	l := &logger{
 		writer: writer,
 		ctx:    make(map[string]Valuer),
+		opts:   o,
 	}
 
 	// Default logs to be info until changed
@@ -98,6 +125,10 @@ var _ Logger = (*logger)(nil)
 type logger struct {
 	writer log.Logger
 	ctx    map[string]Valuer
+	opts   *options
+
+	// span is set for loggers returned from FromContext
+	span trace.Span
 }
 
 func (l *logger) Set(key string, value Valuer) Logger {
@@ -157,6 +188,8 @@ func (l *logger) With(ctxs ...Context) (out Logger) {
 	return &logger{
 		writer: l.writer,
 		ctx:    combined,
+		opts:   l.opts,
+		span:   l.span,
 	}
 }
 
@@ -189,6 +222,17 @@ func (l *logger) Fatal() Logger {
 }
 
 func (l *logger) Log(msg string) {
+	// Dropped lines skip redaction entirely
+	if !l.opts.allow(l.writer, l.level(), msg) {
+		return
+	}
+
+	var redactor *redactor
+	if l.opts != nil {
+		redactor = l.opts.redactor
+	}
+	msg = redactor.text(msg)
+
 	// Frontload the timestamp and msg
 	keyvals := []interface{}{
 		"ts", time.Now().UTC().Format(time.RFC3339),
@@ -199,20 +243,39 @@ func (l *logger) Log(msg string) {
 
 	// Sort the rest of the list so the log lines look similar
 	details := l.Details()
-	keys := make([]string, 0, len(l.ctx))
+	if l.opts != nil && l.opts.caller {
+		details["caller"] = caller(l.opts.callerSkip)
+	}
+	keys := make([]string, 0, len(details))
 	for k := range details {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 
 	// Lets add them into the arguments
+	structured := l.opts != nil && l.opts.structured
 	for _, k := range keys {
-		keyvals = append(keyvals, k, details[k])
+		value := redactor.value(k, details[k])
+		if structured {
+			keyvals = append(keyvals, k, value)
+		} else {
+			keyvals = flatten(keyvals, k, value)
+		}
 	}
 
 	_ = l.writer.Log(keyvals...)
 }
 
+// level returns the level set on this logger, if any.
+func (l *logger) level() Level {
+	if v, ok := l.ctx["level"]; ok && v != nil {
+		if s, ok := v.getValue().(string); ok {
+			return Level(s)
+		}
+	}
+	return ""
+}
+
 func (l *logger) Logf(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
 	l.Log(msg)
@@ -224,7 +287,8 @@ func (l *logger) Send() {
 }
 
 func (l *logger) LogError(err error) LoggedError {
-	l.Set("errored", Bool(true)).Log(err.Error())
+	l.With(errorFields(err, l.opts != nil && l.opts.errorCauses)).Set("errored", Bool(true)).Log(err.Error())
+	l.recordSpanError(err)
 	return LoggedError{err}
 }
 
@@ -1,5 +1,11 @@
 package log
 
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
 // Level just wraps a string to be able to add Context specific to log levels
 type Level string
 
@@ -24,3 +30,57 @@ func (l Level) Context() map[string]Valuer {
 		"level": String(string(l)),
 	}
 }
+
+var levelRanks = map[Level]int{
+	Debug: 0,
+	Info:  1,
+	Warn:  2,
+	Error: 3,
+	Fatal: 4,
+}
+
+// ParseLevel returns the Level named by s, ignoring case and surrounding whitespace.
+func ParseLevel(s string) (Level, error) {
+	level := Level(strings.ToLower(strings.TrimSpace(s)))
+	if level == "warning" {
+		level = Warn
+	}
+	if _, ok := levelRanks[level]; !ok {
+		return "", fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Enabled returns true when l is at or above min. Unknown levels are always enabled.
+func (l Level) Enabled(min Level) bool {
+	rank, ok := levelRanks[l]
+	if !ok {
+		return true
+	}
+	return rank >= levelRanks[min]
+}
+
+// LevelVar is a minimum Level which can be changed while loggers are using it.
+type LevelVar struct {
+	level atomic.Value
+}
+
+// NewLevelVar returns a LevelVar set to level.
+func NewLevelVar(level Level) *LevelVar {
+	v := &LevelVar{}
+	v.Set(level)
+	return v
+}
+
+// Level returns the current minimum Level.
+func (v *LevelVar) Level() Level {
+	if level, ok := v.level.Load().(Level); ok {
+		return level
+	}
+	return Debug
+}
+
+// Set changes the minimum Level.
+func (v *LevelVar) Set(level Level) {
+	v.level.Store(level)
+}
@@ -0,0 +1,214 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Object groups fields under one key. JSON output keeps the nesting while
+// logfmt output flattens the fields into dotted keys (e.g. request.id=...).
+func Object(fields Fields) Valuer {
+	return &object{fields: fields}
+}
+
+type object struct {
+	fields Fields
+}
+
+func (o *object) getValue() interface{} {
+	out := make(map[string]interface{}, len(o.fields))
+	for k, v := range o.fields {
+		if v == nil {
+			out[k] = nil
+			continue
+		}
+		out[k] = v.getValue()
+	}
+	return out
+}
+
+// Array holds a list of values. JSON output writes an array while logfmt output
+// flattens the values into indexed keys (e.g. ids.0=...).
+func Array(vals ...Valuer) Valuer {
+	return &array{vals: vals}
+}
+
+type array struct {
+	vals []Valuer
+}
+
+func (a *array) getValue() interface{} {
+	out := make([]interface{}, len(a.vals))
+	for i, v := range a.vals {
+		if v != nil {
+			out[i] = v.getValue()
+		}
+	}
+	return out
+}
+
+func StringSlice(vals []string) Valuer {
+	return sliceOf(vals, String)
+}
+
+func IntSlice(vals []int) Valuer {
+	return sliceOf(vals, Int)
+}
+
+func Int64Slice(vals []int64) Valuer {
+	return sliceOf(vals, Int64)
+}
+
+func Float64Slice(vals []float64) Valuer {
+	return sliceOf(vals, Float64)
+}
+
+func BoolSlice(vals []bool) Valuer {
+	return sliceOf(vals, Bool)
+}
+
+func sliceOf[T interface{}](vals []T, fn func(T) Valuer) Valuer {
+	out := make([]Valuer, len(vals))
+	for i := range vals {
+		out[i] = fn(vals[i])
+	}
+	return Array(out...)
+}
+
+// DurationMs writes d as a number of milliseconds so it can be aggregated.
+func DurationMs(d time.Duration) Valuer {
+	return Float64(float64(d) / float64(time.Millisecond))
+}
+
+// Err writes the message and type of err along with each error it wraps under "chain".
+func Err(err error) Valuer {
+	if err == nil {
+		return &any{nil}
+	}
+
+	fields := Fields{
+		"message": String(err.Error()),
+		"type":    String(fmt.Sprintf("%T", err)),
+	}
+
+	var chain []Valuer
+	for _, wrapped := range unwrapAll(err) {
+		chain = append(chain, Object(Fields{
+			"message": String(wrapped.Error()),
+			"type":    String(fmt.Sprintf("%T", wrapped)),
+		}))
+	}
+	if len(chain) > 0 {
+		fields["chain"] = Array(chain...)
+	}
+
+	return Object(fields)
+}
+
+// unwrapAll returns every error wrapped by err, depth first, following errors.Join style lists.
+func unwrapAll(err error) []error {
+	var out []error
+	var walk func(error)
+	walk = func(e error) {
+		switch u := e.(type) {
+		case interface{ Unwrap() []error }:
+			for _, inner := range u.Unwrap() {
+				if inner != nil {
+					out = append(out, inner)
+					walk(inner)
+				}
+			}
+		default:
+			if inner := errors.Unwrap(e); inner != nil {
+				out = append(out, inner)
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+	return out
+}
+
+// Any converts v into a Valuer. Maps, slices and structs keep their structure using their
+// JSON encoding, errors are written with Err and other values fall back to fmt formatting.
+func Any(v interface{}) Valuer {
+	switch val := v.(type) {
+	case nil:
+		return &any{nil}
+	case Valuer:
+		return val
+	case Fields:
+		return Object(val)
+	case error:
+		return Err(val)
+	case string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return &any{val}
+	case time.Duration:
+		return TimeDuration(val)
+	case time.Time:
+		return Time(val)
+	case []byte:
+		return ByteString(val)
+	case fmt.Stringer:
+		return Stringer(val)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return &any{nil}
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		bs, err := json.Marshal(v)
+		if err == nil {
+			var out interface{}
+			if err := json.Unmarshal(bs, &out); err == nil {
+				return &any{out}
+			}
+		}
+	}
+
+	return String(fmt.Sprintf("%+v", v))
+}
+
+// flatten appends key/value pairs for value to keyvals, expanding maps and slices into dotted keys.
+func flatten(keyvals []interface{}, key string, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return append(keyvals, key, "{}")
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			keyvals = flatten(keyvals, key+"."+k, v[k])
+		}
+		return keyvals
+
+	case []interface{}:
+		if len(v) == 0 {
+			return append(keyvals, key, "[]")
+		}
+		for i := range v {
+			keyvals = flatten(keyvals, key+"."+strconv.Itoa(i), v[i])
+		}
+		return keyvals
+	}
+
+	return append(keyvals, key, value)
+}
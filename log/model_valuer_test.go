@@ -1,8 +1,14 @@
 package log_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	kitlog "github.com/go-kit/log"
 	"github.com/moov-io/base/log"
 	"github.com/stretchr/testify/require"
 )
@@ -63,3 +69,89 @@ func TestValuer_Stringer(t *testing.T) {
 
 	require.Contains(t, out.String(), `mode=null`)
 }
+
+type wrappedErr struct {
+	err error
+}
+
+func (w *wrappedErr) Error() string { return "wrapped: " + w.err.Error() }
+func (w *wrappedErr) Unwrap() error { return w.err }
+
+func TestValuer_Structured_Logfmt(t *testing.T) {
+	out, logger := log.NewBufferLogger()
+
+	base := errors.New("base")
+	logger.With(log.Fields{
+		"request": log.Object(log.Fields{
+			"id":     log.String("abc"),
+			"status": log.Int(200),
+			"user":   log.Object(log.Fields{"id": log.Int64(7)}),
+		}),
+		"ids":     log.IntSlice([]int{1, 2}),
+		"names":   log.StringSlice(nil),
+		"took":    log.DurationMs(1500 * time.Microsecond),
+		"error":   log.Err(&wrappedErr{err: base}),
+		"payload": log.Any(map[string]interface{}{"a": []int{3}}),
+	}).Log("structured")
+
+	output := out.String()
+	require.Contains(t, output, "request.id=abc request.status=200 request.user.id=7")
+	require.Contains(t, output, "ids.0=1 ids.1=2")
+	require.Contains(t, output, "names=[]")
+	require.Contains(t, output, "took=1.5")
+	require.Contains(t, output, `error.chain.0.message=base error.chain.0.type=*errors.errorString error.message="wrapped: base" error.type=*log_test.wrappedErr`)
+	require.Contains(t, output, "payload.a.0=3")
+}
+
+func TestValuer_Structured_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogger(kitlog.NewJSONLogger(&buf), log.WithStructuredValues())
+
+	logger.With(log.Fields{
+		"request": log.Object(log.Fields{
+			"id":   log.String("abc"),
+			"tags": log.Array(log.String("a"), log.Bool(true)),
+		}),
+		"took":  log.DurationMs(2 * time.Second),
+		"error": log.Err(fmt.Errorf("outer: %w", errors.Join(errors.New("one"), errors.New("two")))),
+		"any":   log.Any(struct{ Name string }{Name: "jane"}),
+	}).Log("structured")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+
+	require.Equal(t, map[string]interface{}{
+		"id":   "abc",
+		"tags": []interface{}{"a", true},
+	}, entry["request"])
+	require.Equal(t, float64(2000), entry["took"])
+	require.Equal(t, map[string]interface{}{"Name": "jane"}, entry["any"])
+
+	errEntry := entry["error"].(map[string]interface{})
+	require.Equal(t, "outer: one\ntwo", errEntry["message"])
+	require.Len(t, errEntry["chain"], 3)
+}
+
+func TestValuer_Any(t *testing.T) {
+	out, logger := log.NewBufferLogger()
+
+	var nilPtr *Item
+	logger.With(log.Fields{
+		"string":   log.Any("value"),
+		"int":      log.Any(3),
+		"duration": log.Any(time.Second),
+		"nil":      log.Any(nil),
+		"nilPtr":   log.Any(nilPtr),
+		"stringer": log.Any(Mode(1)),
+		"channel":  log.Any(make(chan int)),
+	}).Log("")
+
+	output := out.String()
+	require.Contains(t, output, "string=value")
+	require.Contains(t, output, "int=3")
+	require.Contains(t, output, "duration=1s")
+	require.Contains(t, output, "nil=null")
+	require.Contains(t, output, "nilPtr=null")
+	require.Contains(t, output, "stringer=SANDBOX")
+	require.Contains(t, output, "channel=0x")
+}
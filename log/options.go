@@ -0,0 +1,218 @@
+package log
+
+import (
+	"cmp"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// Option configures the filtering done by a Logger. Options are shared by every Logger
+// derived from the original one with Set, With or the level methods.
+type Option func(o *options)
+
+type options struct {
+	level    *LevelVar
+	sampler  *sampler
+	redactor *redactor
+	async    *AsyncConfig
+
+	structured bool
+
+	caller     bool
+	callerSkip int
+
+	spanErrors  bool
+	errorCauses bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithLevel drops log lines below level.
+func WithLevel(level Level) Option {
+	return WithLevelVar(NewLevelVar(level))
+}
+
+// WithLevelVar drops log lines below the current value of v, which can be changed at runtime.
+func WithLevelVar(v *LevelVar) Option {
+	return func(o *options) {
+		o.level = v
+	}
+}
+
+// levelFromEnvironment reads the minimum level from MOOV_LOG_LEVEL or LOG_LEVEL.
+// Unset or unknown values leave every level enabled.
+func levelFromEnvironment() Option {
+	level, err := ParseLevel(cmp.Or(os.Getenv("MOOV_LOG_LEVEL"), os.Getenv("LOG_LEVEL")))
+	if err != nil {
+		return nil
+	}
+	return WithLevel(level)
+}
+
+// WithStructuredValues passes Object and Array values to the writer as maps and slices instead of
+// flattening them into dotted keys. Use this with writers which encode nested values, such as JSON.
+func WithStructuredValues() Option {
+	return func(o *options) {
+		o.structured = true
+	}
+}
+
+// SamplingConfig collapses repeated log lines. Within each Interval the first First lines
+// with the same level and message are written, then only every Thereafter-th line.
+// The number of dropped lines is written once the interval ends, by a goroutine which
+// checks every Interval.
+type SamplingConfig struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int // zero drops every line after First
+}
+
+// WithSampling enables sampling of repeated log lines.
+func WithSampling(cfg SamplingConfig) Option {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return func(o *options) {
+		o.sampler = &sampler{
+			cfg:    cfg,
+			counts: make(map[sampleKey]*sampleCount),
+			stop:   make(chan struct{}),
+		}
+	}
+}
+
+// allow reports if a line at level with msg should be written.
+func (o *options) allow(writer log.Logger, level Level, msg string) bool {
+	if o == nil {
+		return true
+	}
+	if o.level != nil && !level.Enabled(o.level.Level()) {
+		return false
+	}
+	if o.sampler != nil {
+		return o.sampler.allow(writer, o.redactor, level, msg, time.Now())
+	}
+	return true
+}
+
+type sampleKey struct {
+	level Level
+	msg   string
+}
+
+type sampleCount struct {
+	start   time.Time
+	seen    int
+	dropped int
+}
+
+type sampler struct {
+	cfg SamplingConfig
+
+	mu     sync.Mutex
+	counts map[sampleKey]*sampleCount
+
+	// writer and redactor are captured from the first line and used for reports
+	writer   log.Logger
+	redactor *redactor
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+func (s *sampler) allow(writer log.Logger, redactor *redactor, level Level, msg string, now time.Time) bool {
+	s.startOnce.Do(func() {
+		s.writer = writer
+		s.redactor = redactor
+		go s.run()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := sampleKey{level: level, msg: msg}
+	count, ok := s.counts[key]
+	if !ok || now.Sub(count.start) >= s.cfg.Interval {
+		if ok {
+			s.report(key, count)
+		}
+		count = &sampleCount{start: now}
+		s.counts[key] = count
+	}
+
+	count.seen++
+	if count.seen <= s.cfg.First {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (count.seen-s.cfg.First)%s.cfg.Thereafter == 0 {
+		return true
+	}
+	count.dropped++
+	return false
+}
+
+// run reports drops for (and forgets) lines which haven't been logged again within their interval.
+func (s *sampler) run() {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+func (s *sampler) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, count := range s.counts {
+		if now.Sub(count.start) >= s.cfg.Interval {
+			s.report(key, count)
+			delete(s.counts, key)
+		}
+	}
+}
+
+// close stops the reporting goroutine after reporting any remaining drops.
+func (s *sampler) close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for key, count := range s.counts {
+			s.report(key, count)
+			delete(s.counts, key)
+		}
+	})
+}
+
+func (s *sampler) report(key sampleKey, count *sampleCount) {
+	if count.dropped == 0 {
+		return
+	}
+	_ = s.writer.Log(
+		"ts", time.Now().UTC().Format(time.RFC3339),
+		"msg", "dropped sampled log lines",
+		"dropped", count.dropped,
+		"level", string(key.level),
+		"sampled_msg", s.redactor.text(key.msg),
+	)
+}
@@ -0,0 +1,98 @@
+package log_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+func Test_ParseLevel(t *testing.T) {
+	level, err := lib.ParseLevel(" WARNING ")
+	require.NoError(t, err)
+	require.Equal(t, lib.Warn, level)
+
+	level, err = lib.ParseLevel("debug")
+	require.NoError(t, err)
+	require.Equal(t, lib.Debug, level)
+
+	_, err = lib.ParseLevel("verbose")
+	require.ErrorContains(t, err, "unknown log level")
+}
+
+func Test_LevelEnabled(t *testing.T) {
+	require.True(t, lib.Error.Enabled(lib.Warn))
+	require.True(t, lib.Warn.Enabled(lib.Warn))
+	require.False(t, lib.Info.Enabled(lib.Warn))
+	require.True(t, lib.Level("custom").Enabled(lib.Fatal))
+}
+
+func Test_WithLevel(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithLevel(lib.Warn))
+
+	log.Debug().Log("debug message")
+	log.Info().Log("info message")
+	log.Warn().Log("warn message")
+	log.Set("key", lib.String("value")).Error().Log("error message")
+	err := log.Info().LogErrorf("filtered error").Err()
+	require.Error(t, err)
+
+	output := buffer.String()
+	require.NotContains(t, output, "debug message")
+	require.NotContains(t, output, "info message")
+	require.NotContains(t, output, "filtered error")
+	require.Contains(t, output, "warn message")
+	require.Contains(t, output, "error message")
+}
+
+func Test_WithLevelVar(t *testing.T) {
+	level := lib.NewLevelVar(lib.Info)
+	buffer, log := lib.NewBufferLogger(lib.WithLevelVar(level))
+	derived := log.Set("component", lib.String("test"))
+
+	derived.Debug().Log("first")
+	require.Empty(t, buffer.String())
+
+	level.Set(lib.Debug)
+	derived.Debug().Log("second")
+	require.Contains(t, buffer.String(), "msg=second")
+}
+
+func Test_WithSampling(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithSampling(lib.SamplingConfig{
+		Interval:   time.Hour,
+		First:      2,
+		Thereafter: 3,
+	}))
+
+	for i := 0; i < 10; i++ {
+		log.Info().Log("repeated")
+	}
+	log.Warn().Log("repeated") // different level is sampled separately
+	log.Info().Log("other")
+
+	output := buffer.String()
+	require.Equal(t, 4, strings.Count(output, "msg=repeated level=info"), output)
+	require.Equal(t, 1, strings.Count(output, "level=warn"))
+	require.Equal(t, 1, strings.Count(output, "msg=other"))
+}
+
+func Test_WithSampling_ReportsDropped(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithSampling(lib.SamplingConfig{
+		Interval: 50 * time.Millisecond,
+		First:    1,
+	}))
+
+	for i := 0; i < 5; i++ {
+		log.Info().Log("repeated")
+	}
+	require.NotContains(t, buffer.String(), "dropped")
+
+	// Drops are reported without another line being logged
+	require.Eventually(t, func() bool {
+		return strings.Contains(buffer.String(), `msg="dropped sampled log lines" dropped=4 level=info sampled_msg=repeated`)
+	}, time.Second, 10*time.Millisecond, buffer.String())
+}
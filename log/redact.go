@@ -0,0 +1,252 @@
+package log
+
+import (
+	"cmp"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Redacted replaces values removed from log lines.
+const Redacted = "[REDACTED]"
+
+// Redaction describes which values are removed from log lines before they are written.
+//
+// NewDefaultLogger redacts the Keys of DefaultRedaction unless MOOV_LOG_REDACTION (or LOG_REDACTION)
+// is false. Other loggers must be created with WithRedaction.
+type Redaction struct {
+	// Keys are case-insensitive names (e.g. "password" or "accountNumber") matched against the words
+	// of field keys. Keys are split into words on separators and camelCase, so "accountNumber" matches
+	// "account_number" and "user.AccountNumber" but "ssn" doesn't match "business_name". Names may be
+	// glob patterns (e.g. "customer*") which are matched against whole words.
+	Keys []string
+
+	// Detectors find sensitive values within messages and string fields.
+	Detectors []Detector
+}
+
+// Detector finds sensitive values in text. Matches of Pattern are redacted when Valid is nil or returns true.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Valid   func(match string) bool
+}
+
+// DefaultRedaction removes common secrets and PII/PCI data.
+func DefaultRedaction() Redaction {
+	return Redaction{
+		Keys: []string{
+			"password",
+			"passwd",
+			"secret",
+			"token",
+			"apiKey",
+			"authorization",
+			"accountNumber",
+			"routingNumber",
+			"ssn",
+			"taxId",
+			"cardNumber",
+			"pan",
+			"cvv",
+		},
+		Detectors: []Detector{
+			PANDetector,
+			SSNDetector,
+			BearerTokenDetector,
+		},
+	}
+}
+
+var (
+	// PANDetector finds card numbers of 13 to 19 digits, optionally separated by spaces or dashes,
+	// which pass the Luhn check.
+	PANDetector = Detector{
+		Name:    "pan",
+		Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:   luhn,
+	}
+
+	// SSNDetector finds US Social Security Numbers written as AAA-GG-SSSS.
+	SSNDetector = Detector{
+		Name:    "ssn",
+		Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Valid:   validSSN,
+	}
+
+	// BearerTokenDetector finds bearer tokens such as those in Authorization headers.
+	BearerTokenDetector = Detector{
+		Name:    "bearer",
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9\-._~+/]+=*`),
+	}
+)
+
+// WithRedaction removes sensitive values from log lines before they are written. Loggers without
+// this option write every value as given, so applications logging PII or secrets must enable it.
+func WithRedaction(r Redaction) Option {
+	return func(o *options) {
+		o.redactor = newRedactor(r)
+	}
+}
+
+// redactionFromEnvironment redacts the keys of DefaultRedaction unless MOOV_LOG_REDACTION
+// (or LOG_REDACTION) is false.
+func redactionFromEnvironment() Option {
+	if v := cmp.Or(os.Getenv("MOOV_LOG_REDACTION"), os.Getenv("LOG_REDACTION")); v != "" {
+		if enabled, err := strconv.ParseBool(v); err == nil && !enabled {
+			return nil
+		}
+	}
+	return WithRedaction(Redaction{Keys: DefaultRedaction().Keys})
+}
+
+type redactor struct {
+	keys      []string
+	detectors []Detector
+}
+
+func newRedactor(r Redaction) *redactor {
+	out := &redactor{
+		detectors: r.Detectors,
+	}
+	for _, key := range r.Keys {
+		out.keys = append(out.keys, normalizeKey(key))
+	}
+	return out
+}
+
+func (r *redactor) value(key string, value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+
+	if r.redactKey(key) {
+		return Redacted
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.text(v)
+
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, inner := range v {
+			out[k] = r.value(key+"."+k, inner)
+		}
+		return out
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, inner := range v {
+			out[i] = r.value(key, inner)
+		}
+		return out
+	}
+	return value
+}
+
+func (r *redactor) text(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, d := range r.detectors {
+		s = d.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.Valid == nil || d.Valid(match) {
+				return Redacted
+			}
+			return match
+		})
+	}
+	return s
+}
+
+// redactKey reports if any run of consecutive words in key matches a pattern, so "apiKey" matches
+// both "api_key" and "apikey".
+func (r *redactor) redactKey(key string) bool {
+	words := keyWords(key)
+	for i := range words {
+		run := ""
+		for j := i; j < len(words); j++ {
+			run += words[j]
+			for _, pattern := range r.keys {
+				if ok, _ := path.Match(pattern, run); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func normalizeKey(key string) string {
+	return strings.Join(keyWords(key), "")
+}
+
+// keyWords splits key into lowercase words on separators, camelCase and digits.
+// For example "user.APIKey_v2" is split into "user", "api", "key", "v" and "2".
+func keyWords(key string) []string {
+	runes := []rune(key)
+
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	for i, c := range runes {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '*' && c != '?' {
+			flush()
+			continue
+		}
+		if i > 0 && len(current) > 0 {
+			prev := runes[i-1]
+			switch {
+			case unicode.IsUpper(c) && unicode.IsLower(prev):
+				flush() // camelCase
+			case unicode.IsUpper(c) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				flush() // APIKey
+			case unicode.IsDigit(c) != unicode.IsDigit(prev) && c != '*' && prev != '*' && c != '?' && prev != '?':
+				flush() // v2
+			}
+		}
+		current = append(current, c)
+	}
+	flush()
+	return words
+}
+
+// luhn reports if the digits in s pass the Luhn checksum.
+func luhn(s string) bool {
+	var sum, count int
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		count++
+		double = !double
+	}
+	return count >= 13 && sum%10 == 0
+}
+
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
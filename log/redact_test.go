@@ -0,0 +1,134 @@
+package log_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+func Test_Redaction_Keys(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithRedaction(lib.DefaultRedaction()))
+
+	log.With(lib.Fields{
+		"password":       lib.String("hunter2"),
+		"db.Password":    lib.String("hunter2"),
+		"accountNumber":  lib.String("123456789"),
+		"account_number": lib.Int64(123456789),
+		"routing-number": lib.String("987654320"),
+		"name":           lib.String("jane"),
+	}).Log("saving")
+
+	output := buffer.String()
+	require.NotContains(t, output, "hunter2")
+	require.NotContains(t, output, "123456789")
+	require.NotContains(t, output, "987654320")
+	require.Contains(t, output, "password=[REDACTED]")
+	require.Contains(t, output, "account_number=[REDACTED]")
+	require.Contains(t, output, "name=jane")
+}
+
+func Test_Redaction_KeyWords(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithRedaction(lib.DefaultRedaction()))
+
+	log.With(lib.Fields{
+		"user.SSN":         lib.String("secret-1"),
+		"APIKey":           lib.String("secret-2"),
+		"api_key":          lib.String("secret-3"),
+		"accessToken":      lib.String("secret-4"),
+		"business_name":    lib.String("acme"),
+		"className":        lib.String("widget"),
+		"access_number":    lib.String("42"),
+		"tokens_used":      lib.Int64(17),
+		"secretary":        lib.String("jane"),
+		"company_pancakes": lib.String("stack"),
+	}).Log("")
+
+	output := buffer.String()
+	for i := 1; i <= 4; i++ {
+		require.NotContains(t, output, fmt.Sprintf("secret-%d", i))
+	}
+	require.Contains(t, output, "business_name=acme")
+	require.Contains(t, output, "className=widget")
+	require.Contains(t, output, "access_number=42")
+	require.Contains(t, output, "tokens_used=17")
+	require.Contains(t, output, "secretary=jane")
+	require.Contains(t, output, "company_pancakes=stack")
+}
+
+func Test_Redaction_Detectors(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithRedaction(lib.DefaultRedaction()))
+
+	log.With(lib.Fields{
+		"card":    lib.String("4111 1111 1111 1111"),
+		"notcard": lib.String("4111111111111112"),
+		"person":  lib.String("ssn 123-45-6789"),
+		"invalid": lib.String("000-12-3456"),
+		"header":  lib.String("Bearer eyJhbGciOiJIUzI1NiJ9.e30.abc"),
+	}).Logf("charged 4111-1111-1111-1111 for %s", "jane")
+
+	output := buffer.String()
+	require.Contains(t, output, `msg="charged [REDACTED] for jane"`)
+	require.Contains(t, output, "card=[REDACTED]")
+	require.Contains(t, output, "notcard=4111111111111112")
+	require.Contains(t, output, `person="ssn [REDACTED]"`)
+	require.Contains(t, output, "invalid=000-12-3456")
+	require.Contains(t, output, "header=[REDACTED]")
+	require.NotContains(t, output, "eyJhbGciOiJIUzI1NiJ9")
+}
+
+func Test_Redaction_Sampled(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(
+		lib.WithRedaction(lib.DefaultRedaction()),
+		lib.WithSampling(lib.SamplingConfig{Interval: 50 * time.Millisecond, First: 1}),
+	)
+
+	for i := 0; i < 3; i++ {
+		log.Info().Log("charged 4111-1111-1111-1111")
+	}
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(buffer.String(), `sampled_msg="charged [REDACTED]"`)
+	}, time.Second, 10*time.Millisecond)
+	require.NotContains(t, buffer.String(), "4111")
+}
+
+func Test_Redaction_Custom(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithRedaction(lib.Redaction{
+		Keys: []string{"customer*"},
+	}))
+
+	log.Set("customerName", lib.String("jane")).Set("password", lib.String("kept")).Log("")
+
+	output := buffer.String()
+	require.Contains(t, output, "customerName=[REDACTED]")
+	require.Contains(t, output, "password=kept")
+}
+
+func Test_Redaction_StructContext(t *testing.T) {
+	type Account struct {
+		ID     string `log:"id"`
+		Number string `log:"number,redact"`
+		Holder struct {
+			Name string `log:"name"`
+		} `log:"holder,redact"`
+		Empty string `log:"empty,omitempty,redact"`
+	}
+
+	acct := Account{ID: "a1", Number: "123456789"}
+	acct.Holder.Name = "jane"
+
+	buffer, log := lib.NewBufferLogger()
+	log.With(lib.StructContext(acct, lib.WithPrefix("account"))).Log("")
+
+	output := buffer.String()
+	require.Contains(t, output, "account.id=a1")
+	require.Contains(t, output, "account.number=[REDACTED]")
+	require.Contains(t, output, "account.holder=[REDACTED]")
+	require.NotContains(t, output, "jane")
+	require.NotContains(t, output, "account.empty")
+}
@@ -0,0 +1,336 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationConfig controls when a RotatingFile starts a new file and how many old files are kept.
+type RotationConfig struct {
+	Path string
+
+	MaxSize  int64         // rotate once the file would grow beyond this many bytes, zero disables
+	Interval time.Duration // rotate once the file is this old, zero disables
+
+	MaxBackups int           // how many rotated files to keep, zero keeps all
+	Retention  time.Duration // delete rotated files older than this, zero keeps all
+	Compress   bool          // gzip rotated files
+}
+
+// RotatingFile is an io.WriteCloser which writes to a file and rotates it based on size and age.
+// Rotated files are renamed with a timestamp, e.g. app-20250102T150405.000000000.log(.gz).
+//
+// Rotated files are compressed and pruned in the background so writes aren't blocked. Close waits
+// for that to finish and returns any errors from it.
+type RotatingFile struct {
+	cfg RotationConfig
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	cleanupMu  sync.Mutex // one backup is compressed and pruned at a time
+	cleanups   sync.WaitGroup
+	cleanupErr error
+
+	// shared is the path the file is registered under by openSharedRotatingFile and refs
+	// counts the sinks using it.
+	shared string
+	refs   int
+}
+
+var (
+	sharedFilesMu sync.Mutex
+	sharedFiles   = make(map[string]*RotatingFile)
+)
+
+// OpenRotatingFile opens (or creates) cfg.Path for appending.
+func OpenRotatingFile(cfg RotationConfig) (*RotatingFile, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("log file path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+
+	f := &RotatingFile{cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// openSharedRotatingFile returns the RotatingFile already opened for the path of cfg, or opens it.
+// Sinks for the same file then rotate and prune it together instead of renaming it out from under
+// each other. The file is closed once every sink using it is closed.
+func openSharedRotatingFile(cfg RotationConfig) (*RotatingFile, error) {
+	path, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("log file path: %w", err)
+	}
+	cfg.Path = path
+
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+
+	f, exists := sharedFiles[path]
+	if exists {
+		if f.cfg != cfg {
+			return nil, fmt.Errorf("log file %s is already open with other rotation settings", path)
+		}
+	} else {
+		f, err = OpenRotatingFile(cfg)
+		if err != nil {
+			return nil, err
+		}
+		f.shared = path
+		sharedFiles[path] = f
+	}
+	f.refs++
+	return f, nil
+}
+
+// release reports if the last sink using a shared file closed it.
+func (f *RotatingFile) release() bool {
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+
+	f.refs--
+	if f.refs > 0 {
+		return false
+	}
+	if sharedFiles[f.shared] == f {
+		delete(sharedFiles, f.shared)
+	}
+	return true
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file regardless of size or age.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.rotate()
+}
+
+// Close closes the file and waits for rotated files to be compressed and pruned. Files shared by
+// sinks from ParseSinks stay open until each of those sinks is closed.
+func (f *RotatingFile) Close() error {
+	if f.shared != "" && !f.release() {
+		return nil
+	}
+
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.cleanups.Wait()
+
+	f.cleanupMu.Lock()
+	defer f.cleanupMu.Unlock()
+
+	err = errors.Join(err, f.cleanupErr)
+	f.cleanupErr = nil
+	return err
+}
+
+func (f *RotatingFile) shouldRotate(next int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && f.size+next > f.cfg.MaxSize {
+		return true
+	}
+	if f.cfg.Interval > 0 && time.Since(f.openedAt) >= f.cfg.Interval {
+		return true
+	}
+	return false
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("reading log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return fmt.Errorf("closing log file: %w", err)
+		}
+		f.file = nil
+	}
+
+	backup := f.backupName(time.Now())
+	if err := os.Rename(f.cfg.Path, backup); err != nil && !os.IsNotExist(err) {
+		// Keep appending to the current file so later writes aren't lost
+		return errors.Join(fmt.Errorf("renaming log file: %w", err), f.open())
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.cleanups.Add(1)
+	go func() {
+		defer f.cleanups.Done()
+
+		f.cleanupMu.Lock()
+		defer f.cleanupMu.Unlock()
+
+		if err := f.cleanup(backup); err != nil {
+			f.cleanupErr = errors.Join(f.cleanupErr, err)
+		}
+	}()
+	return nil
+}
+
+// cleanup compresses a rotated file and removes the backups no longer kept.
+func (f *RotatingFile) cleanup(backup string) error {
+	if f.cfg.Compress {
+		if err := compressFile(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return f.prune()
+}
+
+const backupLayout = "20060102T150405.000000000"
+
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.cfg.Path)
+	base := strings.TrimSuffix(f.cfg.Path, ext)
+	return fmt.Sprintf("%s-%s%s", base, t.UTC().Format(backupLayout), ext)
+}
+
+// backups returns the rotated files, oldest first. Only names with the exact timestamp layout
+// written by backupName are included, so other files such as app-audit.log are left alone.
+func (f *RotatingFile) backups() ([]string, error) {
+	dir := filepath.Dir(f.cfg.Path)
+	ext := filepath.Ext(f.cfg.Path)
+	base := strings.TrimSuffix(filepath.Base(f.cfg.Path), ext)
+
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(base+"-") + `(\d{8}T\d{6}\.\d{9})` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, entry := range entries {
+		m := pattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		if _, err := time.Parse(backupLayout, m[1]); err != nil {
+			continue
+		}
+		out = append(out, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (f *RotatingFile) prune() error {
+	backups, err := f.backups()
+	if err != nil {
+		return fmt.Errorf("listing rotated log files: %w", err)
+	}
+
+	var remove []string
+	if f.cfg.MaxBackups > 0 && len(backups) > f.cfg.MaxBackups {
+		remove = append(remove, backups[:len(backups)-f.cfg.MaxBackups]...)
+		backups = backups[len(backups)-f.cfg.MaxBackups:]
+	}
+	if f.cfg.Retention > 0 {
+		cutoff := time.Now().Add(-f.cfg.Retention)
+		for _, b := range backups {
+			if info, err := os.Stat(b); err == nil && info.ModTime().Before(cutoff) {
+				remove = append(remove, b)
+			}
+		}
+	}
+
+	for _, r := range remove {
+		if err := os.Remove(r); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing rotated log file: %w", err)
+		}
+	}
+	return nil
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening rotated log file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating compressed log file: %w", err)
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return fmt.Errorf("compressing log file: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("compressing log file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("compressing log file: %w", err)
+	}
+	return os.Remove(path)
+}
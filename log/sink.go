@@ -0,0 +1,243 @@
+package log
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// Sink is one destination for log lines.
+type Sink struct {
+	Name     string
+	Writer   io.Writer
+	Format   string // "logfmt" (default) or "json"
+	MinLevel Level  // lines below MinLevel are not written to this sink, empty writes every level
+}
+
+// NewSinkLogger returns a Logger which writes every line to each of sinks.
+func NewSinkLogger(sinks []Sink, opts ...Option) Logger {
+	opts = append([]Option{WithStructuredValues()}, opts...)
+	return NewLogger(NewMultiWriter(sinks...), opts...)
+}
+
+// MultiWriter is a go-kit log.Logger which writes each line to several sinks.
+type MultiWriter struct {
+	sinks   []Sink
+	writers []log.Logger
+}
+
+// NewMultiWriter returns a MultiWriter for sinks. Lines are passed to json sinks with nested
+// Object and Array values intact and flattened into dotted keys for logfmt sinks.
+func NewMultiWriter(sinks ...Sink) *MultiWriter {
+	w := &MultiWriter{
+		sinks:   sinks,
+		writers: make([]log.Logger, len(sinks)),
+	}
+	for i, sink := range sinks {
+		out := log.NewSyncWriter(sink.Writer)
+		if strings.EqualFold(sink.Format, "json") {
+			w.writers[i] = log.NewJSONLogger(out)
+		} else {
+			w.writers[i] = flattenWriter{next: log.NewLogfmtLogger(out)}
+		}
+	}
+	return w
+}
+
+func (w *MultiWriter) Log(keyvals ...interface{}) error {
+	level := levelOf(keyvals)
+
+	var errs []error
+	for i, sink := range w.sinks {
+		if sink.MinLevel != "" && !level.Enabled(sink.MinLevel) {
+			continue
+		}
+		if err := w.writers[i].Log(keyvals...); err != nil {
+			errs = append(errs, fmt.Errorf("writing to %s log sink: %w", cmp.Or(sink.Name, strconv.Itoa(i)), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the writers of every sink which are io.Closers, other than os.Stdout and os.Stderr.
+func (w *MultiWriter) Close() error {
+	return closeSinks(w.sinks)
+}
+
+func closeSinks(sinks []Sink) error {
+	var errs []error
+	for _, sink := range sinks {
+		if sink.Writer == os.Stdout || sink.Writer == os.Stderr {
+			continue
+		}
+		if c, ok := sink.Writer.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flattenWriter expands nested Object and Array values into dotted keys for writers which
+// don't encode them, such as logfmt.
+type flattenWriter struct {
+	next log.Logger
+}
+
+func (w flattenWriter) Log(keyvals ...interface{}) error {
+	out := make([]interface{}, 0, len(keyvals))
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			out = append(out, keyvals[i], keyvals[i+1])
+			continue
+		}
+		out = flatten(out, key, keyvals[i+1])
+	}
+	return w.next.Log(out...)
+}
+
+// ParseSinks reads a comma separated list of sinks, as used by MOOV_LOG_OUTPUT. Each entry is
+// "stderr", "stdout" or a file such as "file:/var/log/app.log?level=warn&max_size=100MB".
+//
+// Every sink accepts the level and format query parameters. File sinks also accept max_size
+// (e.g. 100MB), rotate (e.g. 24h), max_backups, retention (e.g. 168h) and compress.
+// Sinks without a format use defaultFormat.
+//
+// File sinks for the same path share one RotatingFile, also across calls, so loggers built from
+// the same environment don't rotate the file independently. Its rotation settings must match.
+func ParseSinks(spec string, defaultFormat string) ([]Sink, error) {
+	var sinks []Sink
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		sink, err := parseSink(entry, defaultFormat)
+		if err != nil {
+			// Don't leak the files opened for earlier sinks
+			return nil, errors.Join(fmt.Errorf("log sink %q: %w", entry, err), closeSinks(sinks))
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("no log sinks")
+	}
+	return sinks, nil
+}
+
+func parseSink(entry string, defaultFormat string) (Sink, error) {
+	u, err := url.Parse(entry)
+	if err != nil {
+		return Sink{}, err
+	}
+	query := u.Query()
+
+	sink := Sink{
+		Name:   entry,
+		Format: cmp.Or(query.Get("format"), defaultFormat, "logfmt"),
+	}
+	if s := query.Get("level"); s != "" {
+		sink.MinLevel, err = ParseLevel(s)
+		if err != nil {
+			return Sink{}, err
+		}
+	}
+
+	target := u.Opaque
+	if target == "" {
+		target = u.Path
+	}
+
+	switch {
+	case u.Scheme == "" && target == "stderr":
+		sink.Writer = os.Stderr
+	case u.Scheme == "" && target == "stdout":
+		sink.Writer = os.Stdout
+	case u.Scheme == "file":
+		cfg, err := parseRotation(target, query)
+		if err != nil {
+			return Sink{}, err
+		}
+		sink.Name = target
+		sink.Writer, err = openSharedRotatingFile(cfg)
+		if err != nil {
+			return Sink{}, err
+		}
+	default:
+		return Sink{}, errors.New("unknown sink, expected stderr, stdout or file:<path>")
+	}
+
+	return sink, nil
+}
+
+func parseRotation(path string, query url.Values) (RotationConfig, error) {
+	cfg := RotationConfig{Path: path}
+
+	var err error
+	if s := query.Get("max_size"); s != "" {
+		if cfg.MaxSize, err = parseByteSize(s); err != nil {
+			return cfg, fmt.Errorf("max_size: %w", err)
+		}
+	}
+	if s := query.Get("rotate"); s != "" {
+		if cfg.Interval, err = time.ParseDuration(s); err != nil {
+			return cfg, fmt.Errorf("rotate: %w", err)
+		}
+	}
+	if s := query.Get("max_backups"); s != "" {
+		if cfg.MaxBackups, err = strconv.Atoi(s); err != nil {
+			return cfg, fmt.Errorf("max_backups: %w", err)
+		}
+	}
+	if s := query.Get("retention"); s != "" {
+		if cfg.Retention, err = time.ParseDuration(s); err != nil {
+			return cfg, fmt.Errorf("retention: %w", err)
+		}
+	}
+	if s := query.Get("compress"); s != "" {
+		if cfg.Compress, err = strconv.ParseBool(s); err != nil {
+			return cfg, fmt.Errorf("compress: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// parseByteSize reads sizes such as 1024, 10KB, 100MB or 1GB.
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative size %d", n)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,265 @@
+package log_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+func TestSinkLogger(t *testing.T) {
+	var all, errs bytes.Buffer
+	logger := lib.NewSinkLogger([]lib.Sink{
+		{Name: "all", Writer: &all},
+		{Name: "errors", Writer: &errs, Format: "json", MinLevel: lib.Error},
+	})
+
+	logger.Set("user", lib.Object(lib.Fields{"id": lib.String("u1")})).Info().Log("hello")
+	logger.Error().Log("failed")
+
+	require.Contains(t, all.String(), `msg=hello level=info user.id=u1`)
+	require.Contains(t, all.String(), `msg=failed level=error`)
+
+	require.NotContains(t, errs.String(), "hello")
+	require.Contains(t, errs.String(), `"msg":"failed"`)
+}
+
+func TestParseSinks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	sinks, err := lib.ParseSinks("stderr, file:"+path+"?level=warn&format=json&max_size=10KB&rotate=24h&compress=true", "")
+	require.NoError(t, err)
+	require.Len(t, sinks, 2)
+
+	require.Equal(t, os.Stderr, sinks[0].Writer)
+	require.Equal(t, "logfmt", sinks[0].Format)
+	require.Equal(t, lib.Level(""), sinks[0].MinLevel)
+
+	require.Equal(t, path, sinks[1].Name)
+	require.Equal(t, "json", sinks[1].Format)
+	require.Equal(t, lib.Warn, sinks[1].MinLevel)
+	require.IsType(t, &lib.RotatingFile{}, sinks[1].Writer)
+	require.NoError(t, lib.NewMultiWriter(sinks...).Close())
+
+	_, err = lib.ParseSinks("syslog", "")
+	require.ErrorContains(t, err, "unknown sink")
+
+	_, err = lib.ParseSinks("file:"+path+"?max_size=lots", "")
+	require.ErrorContains(t, err, "max_size")
+
+	_, err = lib.ParseSinks("stdout?level=loud", "")
+	require.Error(t, err)
+}
+
+func TestParseSinks_SharedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	first, err := lib.ParseSinks("file:"+path+"?max_size=20", "")
+	require.NoError(t, err)
+	second, err := lib.ParseSinks("file:"+path+"?max_size=20", "")
+	require.NoError(t, err)
+	require.Same(t, first[0].Writer, second[0].Writer)
+
+	_, err = lib.ParseSinks("file:"+path+"?max_size=10", "")
+	require.ErrorContains(t, err, "already open with other rotation settings")
+
+	// Both sinks see the size of the file and rotate it before it grows past max_size
+	for _, sinks := range [][]lib.Sink{first, second, first} {
+		_, err := sinks[0].Writer.Write([]byte("0123456789abcdef\n"))
+		require.NoError(t, err)
+	}
+
+	// The file stays open until every sink using it is closed
+	require.NoError(t, lib.NewMultiWriter(first...).Close())
+	_, err = second[0].Writer.Write([]byte("0123456789abcdef\n"))
+	require.NoError(t, err)
+	require.NoError(t, lib.NewMultiWriter(second...).Close())
+
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+	for _, file := range append(backups, path) {
+		bs, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.Equal(t, "0123456789abcdef\n", string(bs))
+	}
+}
+
+func TestDefaultLogger_Output(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	t.Setenv("MOOV_LOG_FORMAT", "json")
+	t.Setenv("MOOV_LOG_OUTPUT", "file://"+path)
+
+	lib.NewDefaultLogger().Info().Log("to a file")
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), `"msg":"to a file"`)
+}
+
+func TestDefaultLogger_Redaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	t.Setenv("MOOV_LOG_OUTPUT", "file://"+path)
+
+	lib.NewDefaultLogger().Set("password", lib.String("hunter2")).Log("redacted")
+
+	t.Setenv("MOOV_LOG_REDACTION", "false")
+	lib.NewDefaultLogger().Set("password", lib.String("hunter3")).Log("not redacted")
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), `msg=redacted level=info password=[REDACTED]`)
+	require.NotContains(t, string(bs), "hunter2")
+	require.Contains(t, string(bs), `password=hunter3`)
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	f, err := lib.OpenRotatingFile(lib.RotationConfig{
+		Path:       path,
+		MaxSize:    20,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	for i := 0; i < 5; i++ {
+		_, err := f.Write([]byte("0123456789abcdef\n"))
+		require.NoError(t, err)
+	}
+
+	// Closing waits for the rotated files to be compressed and pruned
+	require.NoError(t, f.Close())
+
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log.gz"))
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	r, err := os.Open(backups[0])
+	require.NoError(t, err)
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	bs, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef\n", string(bs))
+
+	bs, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef\n", string(bs))
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	f, err := lib.OpenRotatingFile(lib.RotationConfig{
+		Path:     path,
+		Interval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	_, err = f.Write([]byte("first\n"))
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = f.Write([]byte("second\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	bs, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second\n", string(bs))
+
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+}
+
+func TestRotatingFile_Retention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	old := filepath.Join(dir, "app-20200101T000000.000000000.log")
+	require.NoError(t, os.WriteFile(old, []byte("old\n"), 0600))
+	stale := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(old, stale, stale))
+
+	f, err := lib.OpenRotatingFile(lib.RotationConfig{
+		Path:      path,
+		Retention: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	_, err = f.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Rotate())
+	require.NoError(t, f.Close())
+
+	_, err = os.Stat(old)
+	require.True(t, os.IsNotExist(err))
+
+	backups, err := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.False(t, strings.HasSuffix(backups[0], "20200101T000000.000000000.log"))
+}
+
+func TestRotatingFile_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	open := func(name string) *lib.RotatingFile {
+		f, err := lib.OpenRotatingFile(lib.RotationConfig{
+			Path:       filepath.Join(dir, name),
+			MaxBackups: 1,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	app, audit := open("app.log"), open("app-audit.log")
+
+	_, err := audit.Write([]byte("audit\n"))
+	require.NoError(t, err)
+	require.NoError(t, audit.Rotate())
+	_, err = audit.Write([]byte("audit\n"))
+	require.NoError(t, err)
+
+	// Pruning app.log backups leaves the other sink's files alone
+	for i := 0; i < 3; i++ {
+		_, err := app.Write([]byte("app\n"))
+		require.NoError(t, err)
+		require.NoError(t, app.Rotate())
+	}
+	require.NoError(t, app.Close())
+	require.NoError(t, audit.Close())
+
+	bs, err := os.ReadFile(filepath.Join(dir, "app-audit.log"))
+	require.NoError(t, err)
+	require.Equal(t, "audit\n", string(bs))
+
+	auditBackups, err := filepath.Glob(filepath.Join(dir, "app-audit-*.log"))
+	require.NoError(t, err)
+	require.Len(t, auditBackups, 1)
+
+	appBackups, err := filepath.Glob(filepath.Join(dir, "app-2*.log"))
+	require.NoError(t, err)
+	require.Len(t, appBackups, 1)
+}
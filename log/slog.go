@@ -0,0 +1,177 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// NewSlogHandler returns a slog.Handler which writes records through logger. Record levels are mapped
+// onto Debug, Info, Warn and Error, attributes become Valuers and groups prefix their keys with "group.".
+func NewSlogHandler(logger Logger) slog.Handler {
+	return &slogHandler{logger: logger}
+}
+
+type slogHandler struct {
+	logger Logger
+	prefix string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if l, ok := h.logger.(*logger); ok && l.opts != nil && l.opts.level != nil {
+		return fromSlogLevel(level).Enabled(l.opts.level.Level())
+	}
+	return true
+}
+
+func (h *slogHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(Fields, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	h.logger.With(fields, fromSlogLevel(record.Level)).Log(record.Message)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(Fields, len(attrs))
+	for _, attr := range attrs {
+		addSlogAttr(fields, h.prefix, attr)
+	}
+	return &slogHandler{
+		logger: h.logger.With(fields),
+		prefix: h.prefix,
+	}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{
+		logger: h.logger,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level >= slog.LevelError:
+		return Error
+	case level >= slog.LevelWarn:
+		return Warn
+	case level >= slog.LevelInfo:
+		return Info
+	default:
+		return Debug
+	}
+}
+
+func toSlogLevel(level string) slog.Level {
+	switch Level(level) {
+	case Debug:
+		return slog.LevelDebug
+	case Warn:
+		return slog.LevelWarn
+	case Error, Fatal:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func addSlogAttr(fields Fields, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, a := range attr.Value.Group() {
+			addSlogAttr(fields, groupPrefix, a)
+		}
+		return
+	}
+
+	fields[prefix+attr.Key] = slogValuer(attr.Value)
+}
+
+func slogValuer(v slog.Value) Valuer {
+	switch v.Kind() {
+	case slog.KindString:
+		return String(v.String())
+	case slog.KindInt64:
+		return Int64(v.Int64())
+	case slog.KindUint64:
+		return Uint64(v.Uint64())
+	case slog.KindFloat64:
+		return Float64(v.Float64())
+	case slog.KindBool:
+		return Bool(v.Bool())
+	case slog.KindDuration:
+		return TimeDuration(v.Duration())
+	case slog.KindTime:
+		return Time(v.Time())
+	}
+
+	switch val := v.Any().(type) {
+	case nil:
+		return &any{nil}
+	case error:
+		return String(val.Error())
+	case fmt.Stringer:
+		return Stringer(val)
+	default:
+		return String(fmt.Sprintf("%+v", val))
+	}
+}
+
+// NewSlogLogger returns a Logger which writes through handler, so moov and slog log lines share one output.
+func NewSlogLogger(handler slog.Handler, opts ...Option) Logger {
+	return NewLogger(&slogWriter{handler: handler}, opts...)
+}
+
+// slogWriter is a go-kit log.Logger which converts keyvals into slog records.
+type slogWriter struct {
+	handler slog.Handler
+}
+
+func (w *slogWriter) Log(keyvals ...interface{}) error {
+	var (
+		msg   string
+		level = slog.LevelInfo
+		attrs = make([]slog.Attr, 0, len(keyvals)/2)
+	)
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		value := keyvals[i+1]
+
+		switch key {
+		case "ts":
+			continue // the handler records its own time
+		case "msg":
+			msg = fmt.Sprint(value)
+		case "level":
+			level = toSlogLevel(fmt.Sprint(value))
+		default:
+			attrs = append(attrs, slog.Any(key, value))
+		}
+	}
+
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	record.AddAttrs(attrs...)
+	return w.handler.Handle(ctx, record)
+}
@@ -0,0 +1,85 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	lib "github.com/moov-io/base/log"
+)
+
+func Test_SlogHandler(t *testing.T) {
+	buffer, log := lib.NewBufferLogger()
+	logger := slog.New(lib.NewSlogHandler(log.Set("app", lib.String("test"))))
+
+	logger.Info("first message", "count", 3, "ok", true, "elapsed", 2*time.Second)
+	output := buffer.String()
+	require.Contains(t, output, `msg="first message"`)
+	require.Contains(t, output, "app=test")
+	require.Contains(t, output, "count=3")
+	require.Contains(t, output, "ok=true")
+	require.Contains(t, output, "elapsed=2s")
+	require.Contains(t, output, "level=info")
+
+	buffer.Reset()
+	logger.With("request_id", "abc").
+		WithGroup("http").
+		Warn("grouped", "status", 404, slog.Group("route", "name", "getUser"))
+	output = buffer.String()
+	require.Contains(t, output, "level=warn")
+	require.Contains(t, output, "request_id=abc")
+	require.Contains(t, output, "http.status=404")
+	require.Contains(t, output, "http.route.name=getUser")
+
+	buffer.Reset()
+	logger.Error("failed", "error", errors.New("boom"))
+	require.Contains(t, buffer.String(), "level=error")
+	require.Contains(t, buffer.String(), "error=boom")
+
+	buffer.Reset()
+	logger.Debug("debug", "n", slog.Uint64Value(7))
+	require.Contains(t, buffer.String(), "level=debug")
+}
+
+func Test_SlogHandler_Enabled(t *testing.T) {
+	buffer, log := lib.NewBufferLogger(lib.WithLevel(lib.Warn))
+	logger := slog.New(lib.NewSlogHandler(log))
+
+	require.False(t, logger.Enabled(t.Context(), slog.LevelInfo))
+	require.True(t, logger.Enabled(t.Context(), slog.LevelError))
+
+	logger.Info("hidden")
+	require.Empty(t, buffer.String())
+}
+
+func Test_SlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	log := lib.NewSlogLogger(handler)
+
+	log.Debug().Log("hidden")
+	require.Empty(t, buf.String())
+
+	log.Set("user_id", lib.Int(42)).Warn().Log("from moov")
+	slog.New(handler).Info("from slog", "user_id", 43)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var first map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[0], &first))
+	require.Equal(t, "from moov", first["msg"])
+	require.Equal(t, "WARN", first["level"])
+	require.Equal(t, float64(42), first["user_id"])
+	require.Contains(t, first, "time")
+	require.NotContains(t, first, "ts")
+
+	var second map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[1], &second))
+	require.Equal(t, "from slog", second["msg"])
+}
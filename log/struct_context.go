@@ -38,7 +38,7 @@ func (sc *structContext) Context() map[string]Valuer {
 }
 
 // StructContext creates a Context from a struct, extracting fields tagged with `log`
-// It supports nested structs and respects omitempty directive
+// It supports nested structs and respects omitempty and redact directives
 func StructContext(v interface{}, opts ...StructContextOption) Context {
 	sc := &structContext{
 		fields: make(map[string]Valuer),
@@ -119,6 +119,12 @@ func extractFields(value reflect.Value, sc *structContext, path string) {
 			continue
 		}
 
+		// Redacted fields are logged without their value (or nested fields)
+		if slices.Contains(tagParts, "redact") {
+			sc.fields[fullName] = String(Redacted)
+			continue
+		}
+
 		// Store the field value
 		valuer := valueToValuer(fieldValue)
 		if valuer != nil {
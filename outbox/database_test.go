@@ -0,0 +1,30 @@
+package outbox_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/outbox"
+)
+
+func TestDatabaseOutbox(t *testing.T) {
+	if testing.Short() {
+		t.Skip("-short flag enabled")
+	}
+
+	for _, dialect := range []string{"mysql", "postgres"} {
+		t.Run(dialect, func(t *testing.T) {
+			setupTracing(t)
+
+			db, config, err := testdb.NewMigratedDatabase(t, dialect, outbox.Migrations)
+			require.NoError(t, err)
+			ob, err := outbox.New(log.NewTestLogger(), db, config)
+			require.NoError(t, err)
+
+			testOutbox(t, ob, db)
+		})
+	}
+}
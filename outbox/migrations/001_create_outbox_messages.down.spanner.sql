@@ -0,0 +1,3 @@
+DROP INDEX outbox_messages_pending;
+
+DROP TABLE outbox_messages;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_messages(
+    id VARCHAR(40) NOT NULL PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    message_key VARCHAR(255) NOT NULL,
+    payload LONGBLOB NOT NULL,
+    headers TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    available_at DATETIME(6) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    lease_owner VARCHAR(255),
+    locked_until DATETIME(6),
+    sent_at DATETIME(6),
+    INDEX outbox_messages_pending (sent_at, available_at)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox_messages(
+    id TEXT NOT NULL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    message_key TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    headers TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    available_at TIMESTAMPTZ NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    lease_owner TEXT,
+    locked_until TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_messages_pending ON outbox_messages (available_at) WHERE sent_at IS NULL;
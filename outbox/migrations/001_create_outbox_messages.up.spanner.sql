@@ -0,0 +1,16 @@
+CREATE TABLE outbox_messages (
+    id STRING(40) NOT NULL,
+    topic STRING(255) NOT NULL,
+    message_key STRING(255) NOT NULL,
+    payload BYTES(MAX) NOT NULL,
+    headers STRING(MAX) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    available_at TIMESTAMP NOT NULL,
+    attempts INT64 NOT NULL,
+    last_error STRING(MAX),
+    lease_owner STRING(255),
+    locked_until TIMESTAMP,
+    sent_at TIMESTAMP,
+) PRIMARY KEY (id);
+
+CREATE INDEX outbox_messages_pending ON outbox_messages (sent_at, available_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox_messages(
+    id TEXT NOT NULL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    message_key TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    headers TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    available_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    lease_owner TEXT,
+    locked_until TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_messages_pending ON outbox_messages (sent_at, available_at);
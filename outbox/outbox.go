@@ -0,0 +1,161 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/log"
+)
+
+// Migrations holds the migrations which create the outbox_messages table, named
+// migrations/001_create_outbox_messages.{up,down}.{mysql,postgres,spanner,sqlite}.sql. Copy the files
+// for your database into your application's migrations, renumbered to follow them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+// Message is an event to publish once the transaction which enqueued it commits.
+type Message struct {
+	ID      string
+	Topic   string
+	Key     string
+	Payload []byte
+
+	// Headers are published with the message and include the trace context of the enqueuing request.
+	Headers map[string]string
+
+	CreatedAt time.Time
+	Attempts  int
+}
+
+// Publisher sends messages to a broker. Messages are delivered at least once, so consumers should
+// ignore repeated message IDs.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc is a function which implements Publisher.
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Outbox stores messages in the outbox_messages table until a relay publishes them.
+type Outbox struct {
+	logger log.Logger
+	db     *sql.DB
+
+	// skipLocked claims batches with SELECT ... FOR UPDATE SKIP LOCKED, otherwise messages are claimed individually
+	skipLocked bool
+	postgres   bool
+	owner      string
+}
+
+// New returns an Outbox using the outbox_messages table in db. MySQL and Postgres relays claim messages
+// with SKIP LOCKED while Spanner and SQLite relays claim them one at a time. Claimed messages are leased
+// to the relay while they're published.
+func New(logger log.Logger, db *sql.DB, config database.DatabaseConfig) (*Outbox, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	o := &Outbox{
+		logger: logger,
+		db:     db,
+		owner:  base.ID(),
+	}
+	switch {
+	case config.MySQL != nil:
+		o.skipLocked = true
+	case config.Postgres != nil:
+		o.skipLocked, o.postgres = true, true
+	case config.Spanner != nil, config.SQLite != nil:
+	default:
+		return nil, errors.New("database config not defined")
+	}
+	return o, nil
+}
+
+// Enqueue adds msg to the outbox as part of tx, so it's only published if tx commits. ID and CreatedAt
+// are set when empty and the trace context of ctx is added to the headers.
+func (o *Outbox) Enqueue(ctx context.Context, tx *sql.Tx, msg Message) (Message, error) {
+	if msg.Topic == "" {
+		return msg, errors.New("outbox message topic is required")
+	}
+	if msg.ID == "" {
+		msg.ID = base.ID()
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	msg.CreatedAt = msg.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	msg.Headers = headers
+
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return msg, fmt.Errorf("encoding outbox message headers: %w", err)
+	}
+	if msg.Payload == nil {
+		msg.Payload = []byte{}
+	}
+
+	qry := o.rebind(`INSERT INTO outbox_messages (id, topic, message_key, payload, headers, created_at, available_at, attempts)
+VALUES (?, ?, ?, ?, ?, ?, ?, 0)`)
+	_, err = tx.ExecContext(ctx, qry, msg.ID, msg.Topic, msg.Key, msg.Payload, string(encoded), msg.CreatedAt, msg.CreatedAt)
+	if err != nil {
+		return msg, fmt.Errorf("enqueueing outbox message: %w", err)
+	}
+	return msg, nil
+}
+
+// Purge deletes messages which were published more than olderThan ago.
+func (o *Outbox) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := o.db.ExecContext(ctx, o.rebind(`DELETE FROM outbox_messages WHERE sent_at IS NOT NULL AND sent_at < ?`), now().Add(-olderThan))
+	if err != nil {
+		return 0, fmt.Errorf("purging outbox messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// rebind replaces ? placeholders with $1, $2, ... on Postgres.
+func (o *Outbox) rebind(qry string) string {
+	if !o.postgres {
+		return qry
+	}
+	var buf strings.Builder
+	n := 0
+	for _, r := range qry {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&buf, "$%d", n)
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,272 @@
+package outbox_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/moov-io/base/database"
+	"github.com/moov-io/base/database/testdb"
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/outbox"
+	"github.com/moov-io/base/telemetry"
+)
+
+func setupSQLite(t *testing.T) (*outbox.Outbox, *sql.DB) {
+	t.Helper()
+
+	db, config, err := testdb.NewMigratedDatabase(t, "sqlite", outbox.Migrations)
+	require.NoError(t, err)
+
+	ob, err := outbox.New(log.NewTestLogger(), db, config)
+	require.NoError(t, err)
+
+	return ob, db
+}
+
+func setupTracing(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return recorder
+}
+
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []outbox.Message
+	spans    []trace.SpanContext
+	err      error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg outbox.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, msg)
+	p.spans = append(p.spans, trace.SpanContextFromContext(ctx))
+	return nil
+}
+
+func (p *recordingPublisher) published() []outbox.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]outbox.Message(nil), p.messages...)
+}
+
+func enqueue(t *testing.T, ctx context.Context, ob *outbox.Outbox, db *sql.DB, msg outbox.Message, commit bool) outbox.Message {
+	t.Helper()
+
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	msg, err = ob.Enqueue(ctx, tx, msg)
+	require.NoError(t, err)
+
+	if commit {
+		require.NoError(t, tx.Commit())
+	} else {
+		require.NoError(t, tx.Rollback())
+	}
+	return msg
+}
+
+func TestOutbox(t *testing.T) {
+	recorder := setupTracing(t)
+	ob, db := setupSQLite(t)
+	testOutbox(t, ob, db)
+
+	// The publish span continues the trace of the enqueuing request
+	var enqueueSpan, publishSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "enqueue":
+			enqueueSpan = span
+		case "outbox-publish":
+			publishSpan = span
+		}
+	}
+	require.NotNil(t, enqueueSpan)
+	require.NotNil(t, publishSpan)
+	require.Equal(t, enqueueSpan.SpanContext().TraceID(), publishSpan.SpanContext().TraceID())
+	require.Equal(t, enqueueSpan.SpanContext().SpanID(), publishSpan.Parent().SpanID())
+	require.Equal(t, trace.SpanKindProducer, publishSpan.SpanKind())
+}
+
+func testOutbox(t *testing.T, ob *outbox.Outbox, db *sql.DB) {
+	t.Helper()
+
+	ctx, span := telemetry.StartSpan(context.Background(), "enqueue")
+	publisher := &recordingPublisher{}
+
+	// Rolled back messages are never published
+	enqueue(t, ctx, ob, db, outbox.Message{Topic: "transfers", Payload: []byte("rolled back")}, false)
+
+	msg := enqueue(t, ctx, ob, db, outbox.Message{
+		Topic:   "transfers",
+		Key:     "transfer-1",
+		Payload: []byte(`{"status":"created"}`),
+		Headers: map[string]string{"content-type": "application/json"},
+	}, true)
+	span.End()
+	require.NotEmpty(t, msg.ID)
+	require.Contains(t, msg.Headers, "traceparent")
+
+	n, err := ob.RelayOnce(ctx, publisher, outbox.RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	published := publisher.published()
+	require.Len(t, published, 1)
+	require.Equal(t, msg.ID, published[0].ID)
+	require.Equal(t, "transfer-1", published[0].Key)
+	require.Equal(t, []byte(`{"status":"created"}`), published[0].Payload)
+	require.Equal(t, "application/json", published[0].Headers["content-type"])
+	require.True(t, msg.CreatedAt.Equal(published[0].CreatedAt))
+
+	// Published headers point at the publish span
+	require.Equal(t, span.SpanContext().TraceID(), publisher.spans[0].TraceID())
+	require.Contains(t, published[0].Headers["traceparent"], publisher.spans[0].SpanID().String())
+
+	// Sent messages aren't published again
+	n, err = ob.RelayOnce(ctx, publisher, outbox.RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	// Claims are committed before publishing, so no locks or transactions are held meanwhile
+	enqueue(t, ctx, ob, db, outbox.Message{Topic: "transfers"}, true)
+	n, err = ob.RelayOnce(ctx, outbox.PublisherFunc(func(ctx context.Context, msg outbox.Message) error {
+		var claimed int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox_messages WHERE sent_at IS NULL AND lease_owner IS NOT NULL`).Scan(&claimed)
+		require.NoError(t, err)
+		require.Equal(t, 1, claimed)
+		return nil
+	}), outbox.RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	time.Sleep(10 * time.Millisecond)
+	purged, err := ob.Purge(ctx, time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), purged)
+}
+
+func TestOutbox_Retry(t *testing.T) {
+	ctx := context.Background()
+	ob, db := setupSQLite(t)
+
+	cfg := outbox.RelayConfig{
+		RetryDelay: 50 * time.Millisecond,
+	}
+	publisher := &recordingPublisher{err: errors.New("broker unavailable")}
+	enqueue(t, ctx, ob, db, outbox.Message{Topic: "transfers"}, true)
+
+	n, err := ob.RelayOnce(ctx, publisher, cfg)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	var attempts int
+	var lastError string
+	require.NoError(t, db.QueryRow(`SELECT attempts, last_error FROM outbox_messages`).Scan(&attempts, &lastError))
+	require.Equal(t, 1, attempts)
+	require.Equal(t, "broker unavailable", lastError)
+
+	// Failed messages wait before they're retried
+	publisher.err = nil
+	n, err = ob.RelayOnce(ctx, publisher, cfg)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	require.Eventually(t, func() bool {
+		n, err := ob.RelayOnce(ctx, publisher, cfg)
+		require.NoError(t, err)
+		return n == 1
+	}, time.Second, 10*time.Millisecond)
+
+	published := publisher.published()
+	require.Len(t, published, 1)
+	require.Equal(t, 1, published[0].Attempts)
+}
+
+func TestOutbox_Leased(t *testing.T) {
+	ctx := context.Background()
+	ob, db := setupSQLite(t)
+	publisher := &recordingPublisher{}
+
+	msg := enqueue(t, ctx, ob, db, outbox.Message{Topic: "transfers"}, true)
+
+	// Messages leased by another relay are skipped until the lease expires
+	_, err := db.Exec(`UPDATE outbox_messages SET lease_owner = 'other', locked_until = ?`, time.Now().UTC().Add(50*time.Millisecond))
+	require.NoError(t, err)
+
+	n, err := ob.RelayOnce(ctx, publisher, outbox.RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	time.Sleep(60 * time.Millisecond)
+	n, err = ob.RelayOnce(ctx, publisher, outbox.RelayConfig{})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, msg.ID, publisher.published()[0].ID)
+}
+
+func TestOutbox_Relay(t *testing.T) {
+	ob, db := setupSQLite(t)
+	publisher := &recordingPublisher{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- ob.Relay(ctx, publisher, outbox.RelayConfig{PollInterval: 10 * time.Millisecond})
+	}()
+
+	for i := 0; i < 3; i++ {
+		enqueue(t, context.Background(), ob, db, outbox.Message{Topic: "transfers"}, true)
+	}
+	require.Eventually(t, func() bool {
+		return len(publisher.published()) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestOutbox_Errors(t *testing.T) {
+	ctx := context.Background()
+	ob, db := setupSQLite(t)
+
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = ob.Enqueue(ctx, tx, outbox.Message{})
+	require.ErrorContains(t, err, "topic is required")
+
+	_, err = ob.RelayOnce(ctx, nil, outbox.RelayConfig{})
+	require.ErrorContains(t, err, "publisher is required")
+
+	_, err = outbox.New(nil, db, database.DatabaseConfig{})
+	require.ErrorContains(t, err, "database config not defined")
+}
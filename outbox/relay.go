@@ -0,0 +1,292 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	kitprom "github.com/go-kit/kit/metrics/prometheus"
+	stdprom "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/moov-io/base/log"
+	"github.com/moov-io/base/telemetry"
+)
+
+var messagesRelayed = kitprom.NewCounterFrom(stdprom.CounterOpts{
+	Name: "outbox_messages_relayed",
+	Help: "Counter of outbox messages relayed to the publisher",
+}, []string{"topic", "outcome"})
+
+// RelayConfig controls how often and how many messages a relay publishes.
+type RelayConfig struct {
+	// BatchSize is the most messages claimed at once, defaults to 100.
+	BatchSize int
+
+	// PollInterval is how long the relay waits after finding no messages, defaults to 1s.
+	PollInterval time.Duration
+
+	// LeaseDuration is how long a relay owns claimed messages before another relay may publish
+	// them, defaults to 1m.
+	LeaseDuration time.Duration
+
+	// RetryDelay is the wait before retrying a failed message. It doubles on each failure
+	// up to MaxRetryDelay. Defaults to 1s and 5m.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+func (cfg RelayConfig) withDefaults() RelayConfig {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = time.Minute
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = time.Second
+	}
+	if cfg.MaxRetryDelay <= 0 {
+		cfg.MaxRetryDelay = 5 * time.Minute
+	}
+	return cfg
+}
+
+// Relay publishes messages until ctx is cancelled. Run it on one or more processes, each relay
+// claims its own batch of messages.
+func (o *Outbox) Relay(ctx context.Context, publisher Publisher, cfg RelayConfig) error {
+	cfg = cfg.withDefaults()
+	for {
+		n, err := o.RelayOnce(ctx, publisher, cfg)
+		if err != nil && ctx.Err() == nil {
+			o.logger.Warn().LogErrorf("relaying outbox messages: %w", err)
+		}
+
+		// Keep going while there's a backlog
+		if err == nil && n >= cfg.BatchSize {
+			continue
+		}
+
+		timer := time.NewTimer(cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of available messages and returns how many were claimed. Messages
+// which fail to publish are retried after a delay.
+func (o *Outbox) RelayOnce(ctx context.Context, publisher Publisher, cfg RelayConfig) (int, error) {
+	if publisher == nil {
+		return 0, errNoPublisher
+	}
+	cfg = cfg.withDefaults()
+	if o.skipLocked {
+		return o.relaySkipLocked(ctx, publisher, cfg)
+	}
+	return o.relayLeased(ctx, publisher, cfg)
+}
+
+var errNoPublisher = errors.New("outbox publisher is required")
+
+const messageColumns = `id, topic, message_key, payload, headers, created_at, attempts`
+
+// relaySkipLocked leases a batch of messages in a transaction, skipping rows other relays have locked,
+// and publishes them once the transaction commits so no locks are held while publishing.
+func (o *Outbox) relaySkipLocked(ctx context.Context, publisher Publisher, cfg RelayConfig) (int, error) {
+	messages, err := o.claimSkipLocked(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		if err := o.publish(ctx, publisher, cfg, msg); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+func (o *Outbox) claimSkipLocked(ctx context.Context, cfg RelayConfig) ([]Message, error) {
+	started := now()
+
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning outbox relay: %w", err)
+	}
+	defer tx.Rollback()
+
+	qry := o.rebind(`SELECT ` + messageColumns + ` FROM outbox_messages
+WHERE sent_at IS NULL AND available_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+ORDER BY available_at LIMIT ? FOR UPDATE SKIP LOCKED`)
+	messages, err := queryMessages(ctx, tx, qry, started, started, cfg.BatchSize)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+
+	args := []any{started.Add(cfg.LeaseDuration), o.owner}
+	placeholders := make([]string, len(messages))
+	for i, msg := range messages {
+		placeholders[i] = "?"
+		args = append(args, msg.ID)
+	}
+	claim := o.rebind(`UPDATE outbox_messages SET locked_until = ?, lease_owner = ?
+WHERE id IN (` + strings.Join(placeholders, ", ") + `)`)
+	if _, err := tx.ExecContext(ctx, claim, args...); err != nil {
+		return nil, fmt.Errorf("claiming outbox messages: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing outbox relay: %w", err)
+	}
+	return messages, nil
+}
+
+// relayLeased claims each message by setting a lease on it, for databases without SKIP LOCKED.
+func (o *Outbox) relayLeased(ctx context.Context, publisher Publisher, cfg RelayConfig) (int, error) {
+	started := now()
+
+	qry := o.rebind(`SELECT ` + messageColumns + ` FROM outbox_messages
+WHERE sent_at IS NULL AND available_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+ORDER BY available_at LIMIT ?`)
+	candidates, err := queryMessages(ctx, o.db, qry, started, started, cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	claim := o.rebind(`UPDATE outbox_messages SET locked_until = ?, lease_owner = ?
+WHERE id = ? AND sent_at IS NULL AND (locked_until IS NULL OR locked_until < ?)`)
+
+	claimed := 0
+	for _, msg := range candidates {
+		res, err := o.db.ExecContext(ctx, claim, started.Add(cfg.LeaseDuration), o.owner, msg.ID, started)
+		if err != nil {
+			return claimed, fmt.Errorf("claiming outbox message %s: %w", msg.ID, err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue // another relay claimed it first
+		}
+		claimed++
+
+		if err := o.publish(ctx, publisher, cfg, msg); err != nil {
+			return claimed, err
+		}
+	}
+	return claimed, nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func queryMessages(ctx context.Context, q querier, qry string, args ...any) ([]Message, error) {
+	rows, err := q.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var msg Message
+		var headers string
+		err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &headers, &msg.CreatedAt, &msg.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("scanning outbox message: %w", err)
+		}
+		if err := json.Unmarshal([]byte(headers), &msg.Headers); err != nil {
+			return nil, fmt.Errorf("decoding outbox message %s headers: %w", msg.ID, err)
+		}
+		msg.CreatedAt = msg.CreatedAt.UTC()
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// publish sends msg with the trace context it was enqueued with and records the outcome. Messages
+// are only updated while the relay still holds their lease.
+func (o *Outbox) publish(ctx context.Context, publisher Publisher, cfg RelayConfig, msg Message) error {
+	pubCtx := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Headers))
+	pubCtx, span := telemetry.StartSpan(pubCtx, "outbox-publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("outbox.message_id", msg.ID),
+			attribute.String("outbox.topic", msg.Topic),
+			attribute.Int("outbox.attempts", msg.Attempts),
+		),
+	)
+	defer span.End()
+
+	// Consumers continue the trace from the publish span
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	otel.GetTextMapPropagator().Inject(pubCtx, propagation.MapCarrier(headers))
+	msg.Headers = headers
+
+	logger := o.logger.With(log.Fields{
+		"message_id": log.String(msg.ID),
+		"topic":      log.String(msg.Topic),
+	})
+
+	var args []any
+	var qry string
+
+	pubErr := publisher.Publish(pubCtx, msg)
+	if pubErr == nil {
+		messagesRelayed.With("topic", msg.Topic, "outcome", "sent").Add(1)
+
+		qry = `UPDATE outbox_messages SET sent_at = ?, locked_until = NULL, lease_owner = NULL WHERE id = ? AND lease_owner = ?`
+		args = []any{now(), msg.ID, o.owner}
+	} else {
+		messagesRelayed.With("topic", msg.Topic, "outcome", "failed").Add(1)
+		span.RecordError(pubErr)
+		span.SetStatus(codes.Error, pubErr.Error())
+
+		delay := retryDelay(cfg, msg.Attempts+1)
+		logger.Warn().Set("attempts", log.Int(msg.Attempts+1)).LogErrorf("publishing outbox message, retrying in %v: %w", delay, pubErr)
+
+		qry = `UPDATE outbox_messages SET attempts = ?, last_error = ?, available_at = ?, locked_until = NULL, lease_owner = NULL WHERE id = ? AND lease_owner = ?`
+		args = []any{msg.Attempts + 1, pubErr.Error(), now().Add(delay), msg.ID, o.owner}
+	}
+
+	res, err := o.db.ExecContext(ctx, o.rebind(qry), args...)
+	if err != nil {
+		return fmt.Errorf("updating outbox message %s: %w", msg.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		logger.Warn().Log("outbox message lease expired before it was updated, it may be published again")
+	}
+	return nil
+}
+
+// retryDelay doubles RetryDelay for each attempt up to MaxRetryDelay.
+func retryDelay(cfg RelayConfig, attempts int) time.Duration {
+	delay := cfg.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= cfg.MaxRetryDelay {
+			return cfg.MaxRetryDelay
+		}
+	}
+	return min(delay, cfg.MaxRetryDelay)
+}
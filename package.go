@@ -13,3 +13,6 @@ var SpannerMigrations embed.FS
 
 //go:embed migrations/*.up.postgres.sql
 var PostgresMigrations embed.FS
+
+//go:embed migrations/*.up.sql migrations/*.up.sqlite.sql
+var SQLiteMigrations embed.FS
@@ -0,0 +1,72 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package pkgerfs reads files packed by github.com/markbates/pkger as an fs.FS, so services still
+// using pkger can pass them to anything reading an fs.FS. database.NewPkgerSource and the default
+// migration source read through it.
+//
+// The pkger tool only packs the files an application references, e.g. with pkger.Include("/configs")
+// and pkger.Include("/migrations").
+//
+// Deprecated: pkger is archived. Use an embed.FS instead.
+package pkgerfs
+
+import (
+	"io/fs"
+	"sort"
+
+	"github.com/markbates/pkger"
+)
+
+// FS reads the files packed by pkger, or the module's files when they aren't packed. Names are
+// relative to the root of the module, such as configs/config.default.yml.
+var FS fs.FS = pkgerFS{}
+
+type pkgerFS struct{}
+
+func (pkgerFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := pkger.Open(pkgerPath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (pkgerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := pkger.Open(pkgerPath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	defer f.Close()
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// pkgerPath converts an fs.FS name into a pkger path from the module root.
+func pkgerPath(name string) string {
+	if name == "." {
+		return "/"
+	}
+	return "/" + name
+}
@@ -0,0 +1,26 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package pkgerfs
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	bs, err := fs.ReadFile(FS, "configs/config.default.yml")
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "Default")
+
+	entries, err := fs.ReadDir(FS, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	require.Equal(t, "001_create_tests.up.sql", entries[0].Name())
+
+	_, err = FS.Open("../configs")
+	require.ErrorIs(t, err, fs.ErrInvalid)
+}
@@ -12,7 +12,7 @@ import (
 )
 
 type OtelConfig struct {
-	Host string
+	Host string `validate:"required,hostport"`
 	TLS  bool
 }
 
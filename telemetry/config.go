@@ -2,6 +2,7 @@ package telemetry
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"time"
@@ -25,6 +26,17 @@ type Config struct {
 	testWriter io.Writer
 }
 
+// Validate requires a ServiceName (or MOOV_SERVICE_NAME) once an exporter is configured.
+func (config *Config) Validate() error {
+	exporting := config.Stdout || config.OpenTelemetryCollector != nil || config.Honeycomb != nil ||
+		isOtelEnvironmentSet() || isHoneycombEnvironmentSet()
+
+	if exporting && config.ServiceName == "" && os.Getenv("MOOV_SERVICE_NAME") == "" {
+		return errors.New("service name is required when exporting traces")
+	}
+	return nil
+}
+
 // Allows for testing where the output of the traces are sent to a io.Writer instance.
 func TestConfig(w io.Writer) Config {
 	return Config{